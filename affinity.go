@@ -0,0 +1,87 @@
+package pool
+
+import (
+	"context"
+)
+
+// GetForKey implements the Pool interfaces GetForKey() method.
+func (c *channelPool) GetForKey(key string) (Conn, error) {
+	ctx := context.Background()
+	// the affine rconn is subject to the same checks as any other
+	if _, _, err := c.admit(ctx); err != nil {
+		return nil, err
+	}
+
+	if e := c.takeAffine(key); e != nil && c.usable(ctx, e, nil) {
+		p := c.wrapRconn(e, "")
+		p.key = key
+		return p, nil
+	}
+
+	rconn, err := c.get(ctx, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	rconn.(*PoolRconn).key = key
+	return rconn, nil
+}
+
+// takeAffine removes from the idle channel and returns the rconn
+// associated to key, if it is idle. The relative order of the other
+// idle rconns is kept.
+func (c *channelPool) takeAffine(key string) *rconnEntry {
+	c.affinityMu.Lock()
+	want := c.affinity[key]
+	c.affinityMu.Unlock()
+
+	if want == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	found := c.rotate(func(e *rconnEntry) bool { return e != want })
+	c.mu.Unlock()
+
+	if len(found) == 0 {
+		// checked out or closed in the meantime. want may be owned by
+		// another goroutine, so only the map is updated
+		c.affinityMu.Lock()
+		if c.affinity[key] == want {
+			delete(c.affinity, key)
+		}
+		c.affinityMu.Unlock()
+		return nil
+	}
+	return found[0]
+}
+
+// setAffinity associates the rconn of e to key, replacing any
+// previous key of e. As associations are forgotten as soon as their
+// rconn is checked out or closed, only idle rconns are associated.
+func (c *channelPool) setAffinity(key string, e *rconnEntry) {
+	c.affinityMu.Lock()
+	defer c.affinityMu.Unlock()
+
+	if e.affinityKey != "" && c.affinity[e.affinityKey] == e {
+		delete(c.affinity, e.affinityKey)
+	}
+	if c.affinity == nil {
+		c.affinity = map[string]*rconnEntry{}
+	}
+	c.affinity[key] = e
+	e.affinityKey = key
+}
+
+// forgetAffinity removes the key associated to the rconn of e, if any.
+func (c *channelPool) forgetAffinity(e *rconnEntry) {
+	if e.affinityKey == "" {
+		return
+	}
+
+	c.affinityMu.Lock()
+	if c.affinity[e.affinityKey] == e {
+		delete(c.affinity, e.affinityKey)
+	}
+	e.affinityKey = ""
+	c.affinityMu.Unlock()
+}
@@ -0,0 +1,150 @@
+package pool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPool_GetForKey(t *testing.T) {
+	p, err := NewChannelPool(3, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, err := p.GetForKey("session")
+	if err != nil {
+		t.Fatalf("GetForKey error: %s", err)
+	}
+	first := rconn.(*PoolRconn).RpcAble
+	rconn.Close() // now at the back of the idle queue
+
+	rconn, err = p.GetForKey("session")
+	if err != nil {
+		t.Fatalf("GetForKey error: %s", err)
+	}
+	if rconn.(*PoolRconn).RpcAble != first {
+		t.Errorf("GetForKey error. Expecting the same rconn for the same key")
+	}
+
+	// the affine rconn is checked out, so another one is returned
+	other, err := p.GetForKey("session")
+	if err != nil {
+		t.Fatalf("GetForKey error: %s", err)
+	}
+	if other.(*PoolRconn).RpcAble == first {
+		t.Errorf("GetForKey error. A checked-out rconn cannot be returned twice")
+	}
+	other.Close()
+	rconn.Close()
+
+	if p.Len() != 3 {
+		t.Errorf("GetForKey error. Expecting %d, got %d", 3, p.Len())
+	}
+}
+
+func TestPool_GetForKeyBounded(t *testing.T) {
+	p, err := NewChannelPool(0, 2, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	affinityLen := func() int {
+		c := p.(*channelPool)
+		c.affinityMu.Lock()
+		defer c.affinityMu.Unlock()
+		return len(c.affinity)
+	}
+
+	for i := 0; i < 1000; i++ {
+		rconn, err := p.GetForKey(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatalf("GetForKey error: %s", err)
+		}
+		rconn.Close()
+	}
+
+	// only idle rconns are associated to a key
+	if n := affinityLen(); n > p.Len() {
+		t.Errorf("GetForKey error. Expecting at most %d keys, got %d", p.Len(), n)
+	}
+
+	// checked out rconns are not associated anymore
+	rconn, _ := p.Get()
+	if n := affinityLen(); n > p.Len() {
+		t.Errorf("GetForKey error. Expecting at most %d keys, got %d", p.Len(), n)
+	}
+	rconn.Close()
+
+	p.Close()
+	if n := affinityLen(); n != 0 {
+		t.Errorf("GetForKey error. Expecting no key once closed, got %d", n)
+	}
+}
+
+func TestPool_GetForKeyExpired(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, _ := p.GetForKey("session")
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	rconn.Close()
+
+	p.SetConnMaxLifetime(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	rconn, err = p.GetForKey("session")
+	if err != nil {
+		t.Fatalf("GetForKey error: %s", err)
+	}
+	defer rconn.Close()
+	if rconn.(*PoolRconn).RpcAble == stub || !stub.isClosed() {
+		t.Errorf("GetForKey error. Expired affine rconn should be closed")
+	}
+}
+
+func TestPool_GetForKeyPaused(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rconn, _ := p.GetForKey("session")
+	rconn.Close()
+
+	p.Pause()
+	got := make(chan error)
+	go func() {
+		rconn, err := p.GetForKey("session")
+		if err == nil {
+			rconn.Close()
+		}
+		got <- err
+	}()
+
+	// the affine rconn is idle, but the pool is paused
+	select {
+	case err := <-got:
+		t.Fatalf("GetForKey error. Expecting to block while paused, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.Resume()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Errorf("GetForKey error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GetForKey error. Still blocked after Resume()")
+	}
+
+	p.Close()
+	if _, err := p.GetForKey("session"); err != ErrClosed {
+		t.Errorf("GetForKey error. Expecting %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,64 @@
+package pool
+
+// asyncCloseWorkers is the number of goroutines closing RPC-able
+// connections in the background when WithAsyncClose() is enabled.
+const asyncCloseWorkers = 4
+
+// asyncCloseQueue is the number of RPC-able connections that can wait
+// to be closed in the background. Once full, they are closed
+// synchronously.
+const asyncCloseQueue = 64
+
+// startAsyncClose starts the background closing workers.
+func (c *channelPool) startAsyncClose() {
+	c.closeQueue = make(chan *rconnEntry, asyncCloseQueue)
+	c.closeDone = make(chan struct{})
+
+	c.closeWg.Add(asyncCloseWorkers)
+	for i := 0; i < asyncCloseWorkers; i++ {
+		go func() {
+			defer c.closeWg.Done()
+			for e := range c.closeQueue {
+				c.closeRconn(e)
+			}
+		}()
+	}
+
+	go func() {
+		c.closeWg.Wait()
+		close(c.closeDone)
+	}()
+}
+
+// stopAsyncClose makes the background closing workers exit once the
+// queued RPC-able connections are closed. Next discard() calls close
+// RPC-able connections synchronously.
+func (c *channelPool) stopAsyncClose() {
+	if c.closeQueue == nil {
+		return
+	}
+
+	c.closeMu.Lock()
+	c.closeStopped = true
+	close(c.closeQueue)
+	c.closeMu.Unlock()
+}
+
+// discard closes the RPC-able connection of e on behalf of the pool,
+// in the background if WithAsyncClose() is enabled and the queue is
+// not full, in which case it always returns nil.
+func (c *channelPool) discard(e *rconnEntry) error {
+	if c.closeQueue != nil {
+		c.closeMu.RLock()
+		if !c.closeStopped {
+			select {
+			case c.closeQueue <- e:
+				c.closeMu.RUnlock()
+				return nil
+			default:
+			}
+		}
+		c.closeMu.RUnlock()
+	}
+	return c.closeRconn(e)
+}
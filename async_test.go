@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPool_AsyncClose(t *testing.T) {
+	unblock := make(chan struct{})
+	p, err := NewChannelPool(0, 1, func() (RpcAble, error) {
+		return &blockingRconn{unblock: unblock}, nil
+	}, WithAsyncClose(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+	slow1 := rconn1.(*PoolRconn).RpcAble.(*blockingRconn)
+	slow2 := rconn2.(*PoolRconn).RpcAble.(*blockingRconn)
+	slow3 := &blockingRconn{unblock: unblock}
+
+	start := time.Now()
+
+	// the pool is full, so slow2 and slow3 are closed in the background
+	rconn1.Close()
+	if err := rconn2.Close(); err != nil {
+		t.Errorf("Close error: %s", err)
+	}
+	if err := p.Put(slow3); err != ErrFull {
+		t.Errorf("Put error. Expecting %v, got %v", ErrFull, err)
+	}
+
+	// unusable slow1 is closed in the background too
+	rconn, _ := p.Get()
+	rconn.MarkUnusable()
+	if err := rconn.Close(); err != nil {
+		t.Errorf("Close error: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("AsyncClose error. Returning rconns took too long: %s", elapsed)
+	}
+	if slow1.isClosed() || slow2.isClosed() || slow3.isClosed() {
+		t.Errorf("AsyncClose error. Slow rconns should not be closed yet")
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() { close(unblock) })
+
+	// Close() waits for background closes
+	p.Close()
+	if !slow1.isClosed() || !slow2.isClosed() || !slow3.isClosed() {
+		t.Errorf("AsyncClose error. Slow rconns should be closed")
+	}
+	if closed := p.Stats().Closed; closed != 3 {
+		t.Errorf("AsyncClose error. Expecting %d closed, got %d", 3, closed)
+	}
+}
@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff computes jittered exponential backoff delays, see
+// WithDialBackoff(). Its zero value means no delay.
+type Backoff struct {
+	// Base is the delay before the first retry.
+	Base time.Duration
+	// Max caps the delays, jitter included. A zero Max means no cap.
+	Max time.Duration
+	// Factor multiplies the delay at each attempt. A Factor lower
+	// than 1 is taken as 2.
+	Factor float64
+	// Jitter is the fraction of the delay by which it is randomly
+	// shifted, up or down, to avoid synchronized retries. It is
+	// clamped to [0, 1].
+	Jitter float64
+}
+
+// Next returns the delay to wait before retrying after attempt
+// failed, attempt starting at 0.
+func (b *Backoff) Next(attempt int) time.Duration {
+	if b == nil || b.Base <= 0 {
+		return 0
+	}
+	if attempt < 0 {
+		attempt = 0
+	}
+
+	factor := b.Factor
+	if factor < 1 {
+		factor = 2
+	}
+	d := float64(b.Base) * math.Pow(factor, float64(attempt))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+
+	if jitter := math.Min(math.Max(b.Jitter, 0), 1); jitter > 0 {
+		d += (2*rand.Float64() - 1) * jitter * d
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,93 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Next(t *testing.T) {
+	b := &Backoff{Base: 10 * time.Millisecond, Max: time.Second, Factor: 2}
+	for attempt, expected := range []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		160 * time.Millisecond,
+		320 * time.Millisecond,
+		640 * time.Millisecond,
+		time.Second, // capped
+		time.Second,
+	} {
+		if d := b.Next(attempt); d != expected {
+			t.Errorf("Next(%d) error. Expecting %s, got %s", attempt, expected, d)
+		}
+	}
+	if d := b.Next(1000); d != time.Second {
+		t.Errorf("Next(1000) error. Expecting %s, got %s", time.Second, d)
+	}
+
+	// default factor
+	b = &Backoff{Base: time.Millisecond}
+	if d := b.Next(3); d != 8*time.Millisecond {
+		t.Errorf("Next error. Expecting %s, got %s", 8*time.Millisecond, d)
+	}
+
+	// no delay
+	if d := (*Backoff)(nil).Next(3); d != 0 {
+		t.Errorf("Next error. Expecting 0 for a nil Backoff, got %s", d)
+	}
+	if d := (&Backoff{}).Next(3); d != 0 {
+		t.Errorf("Next error. Expecting 0 for a zero Backoff, got %s", d)
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	b := &Backoff{Base: 100 * time.Millisecond, Max: 300 * time.Millisecond, Factor: 2, Jitter: 0.5}
+	for i := 0; i < 1000; i++ {
+		if d := b.Next(0); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("Next error. Expecting [50ms, 150ms], got %s", d)
+		}
+		// the cap applies to the jittered delay
+		if d := b.Next(5); d < 150*time.Millisecond || d > 300*time.Millisecond {
+			t.Fatalf("Next error. Expecting [150ms, 300ms], got %s", d)
+		}
+	}
+}
+
+func TestPool_DialBackoff(t *testing.T) {
+	fc := newFakeClock()
+	calls := make(chan struct{}, 3)
+	p, _ := NewChannelPool(0, 1, func() (RpcAble, error) {
+		calls <- struct{}{}
+		return nil, errors.New("down")
+	}, withClock(fc), WithDialAttempts(3),
+		WithDialBackoff(&Backoff{Base: time.Second, Factor: 3}))
+	defer p.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := p.Get()
+		errs <- err
+	}()
+
+	for _, delay := range []time.Duration{time.Second, 3 * time.Second} {
+		<-calls
+		fc.BlockUntil(1)
+		fc.Advance(delay - time.Millisecond)
+		if len(calls) != 0 {
+			t.Fatalf("DialBackoff error. Attempt occurred before %s", delay)
+		}
+		fc.Advance(time.Millisecond)
+	}
+	<-calls
+
+	select {
+	case err := <-errs:
+		if err == nil || err.Error() != "down" {
+			t.Errorf("Get error. Expecting down, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DialBackoff error. Get() still waiting")
+	}
+}
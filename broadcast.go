@@ -0,0 +1,31 @@
+package pool
+
+import (
+	"sync"
+)
+
+// Broadcast implements the Pool interfaces Broadcast() method.
+func (c *channelPool) Broadcast(serviceMethod string, args interface{}) []error {
+	idle := c.takeIdle(c.Len())
+
+	errs := make([]error, len(idle))
+	var wg sync.WaitGroup
+	for i, e := range idle {
+		wg.Add(1)
+		go func(i int, e *rconnEntry) {
+			defer wg.Done()
+			errs[i] = e.rconn.Call(serviceMethod, args, nil)
+		}(i, e)
+	}
+	wg.Wait()
+
+	for i, e := range idle {
+		if errs[i] != nil {
+			c.emit(EventDiscarded)
+			c.retire(e)
+		} else {
+			c.put(e)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,55 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPool_Broadcast(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	stubs := []*stubRconn{{id: 1}, {id: 2, callErr: errors.New("failed")}, {id: 3}}
+	for _, stub := range stubs {
+		p.Put(stub)
+	}
+
+	// a checked-out rconn is not part of the broadcast
+	busy, _ := p.Get()
+	defer busy.Close()
+
+	errs := p.Broadcast("Cache.Invalidate", "key")
+	if len(errs) != 2 {
+		t.Fatalf("Broadcast error. Expecting %d results, got %d", 2, len(errs))
+	}
+
+	if stubs[0].callCount() != 0 {
+		t.Errorf("Broadcast error. Checked-out rconn should not be called")
+	}
+	for _, stub := range stubs[1:] {
+		if stub.callCount() != 1 {
+			t.Errorf("Broadcast error. Rconn #%d called %d times", stub.id, stub.callCount())
+		}
+	}
+
+	nErrs := 0
+	for _, err := range errs {
+		if err != nil {
+			nErrs++
+		}
+	}
+	if nErrs != 1 {
+		t.Errorf("Broadcast error. Expecting %d error, got %d", 1, nErrs)
+	}
+
+	// failing rconn is retired
+	if !stubs[1].isClosed() || stubs[2].isClosed() {
+		t.Errorf("Broadcast error. Only the failing rconn should be closed")
+	}
+	if p.Len() != 1 {
+		t.Errorf("Broadcast error. Expecting %d, got %d", 1, p.Len())
+	}
+}
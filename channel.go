@@ -1,131 +1,1947 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/rpc"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// minIdleInterval is the interval at which the idle count is checked
+// against the WithMinIdle() setting, in addition to the checks
+// triggered by Get().
+var minIdleInterval = time.Second
+
+// errInvalid is the error reported when a per-call validation
+// predicate rejects an RPC-able connection.
+var errInvalid = errors.New("rconn is invalid")
+
+// errWrongPool is the error returned when an RPC-able connection is
+// put back to a pool that does not own it.
+var errWrongPool = errors.New("rconn belongs to another pool. rejecting")
+
 // channelPool implements the Pool interface based on buffered channels.
 type channelPool struct {
-	// storage for our RPC-able connections
+	// statistics, accessed atomically
+	created   int64
+	closed    int64
+	waitCount int64
+	inUse     int64
+	// number of idle rconns, incremented before sending to rconns and
+	// decremented after receiving from it, accessed atomically
+	idle int64
+	// average call latency in nanoseconds, accessed atomically
+	avgLatency int64
+	// number of rconns closed by reason, accessed atomically
+	maxIdleClosed     int64
+	idleTimeoutClosed int64
+	maxLifetimeClosed int64
+	// number of rconns created by the failover factory, accessed
+	// atomically
+	failoverCreated int64
+	// number of Get() calls currently waiting and of those refused by
+	// WithMaxWaiters(), accessed atomically
+	waiters   int64
+	exhausted int64
+	// factory calls error rate, float64 bits accessed atomically
+	dialErrorRate uint64
+	// number of nil or mismatched rconns returned, accessed atomically
+	badPuts int64
+
+	// number of open rconns, idle or checked out, and its
+	// SetMaxOpenConns() limit, accessed atomically
+	numOpen int64
+	maxOpen int64
+	// number of open rconns dialed beyond maxOpen, see
+	// WithOverflowAllowance(), accessed atomically
+	numOverflow int64
+	// WithSharedLimiter() limiter, shared with other pools
+	limiter *Limiter
+	// SetConnMaxLifetime() and SetConnMaxIdleTime() durations in
+	// nanoseconds, accessed atomically
+	maxLifetime int64
+	maxIdleTime int64
+	// shortest IdleLimited idle time seen, accessed atomically
+	minIdleTTL int64
+
+	// generation of newly created RPC-able connections, bumped by
+	// Reset(), accessed atomically
+	gen uint64
+	// number of open rconns per generation and, for a weighted pool,
+	// per backend
+	trackMu  sync.Mutex
+	gens     map[uint64]int
+	backends map[string]int
+
+	initialCap int
+	maxCap     int
+
+	// storage for our RPC-able connections. Sends to rconns always
+	// occur with mu held and after checking rconns is not nil, while
+	// shutdown() sets it to nil with mu held before closing the
+	// channel, so a send never races with the close
 	mu     sync.Mutex
-	rconns chan RpcAble
+	rconns chan *rconnEntry
+	// *poolState mirroring rconns and factory, so the Get() path can
+	// read them without locking mu
+	state atomic.Value
+	// SetMaxIdleConns() limit, lower or equal to maxCap
+	maxIdle int
+	// true if returned rconns are put at the front of rconns
+	returnToFront bool
+	// true once the reaper goroutine is started
+	reaping bool
+
+	// closed on the next change that could allow a waiting Get() call
+	// to succeed, created on demand
+	changedMu sync.Mutex
+	changed   chan struct{}
 
 	// RpcAble generator
-	factory Factory
+	factory metaFactory
+	// true if factory ignores its context
+	legacy      bool
+	dialTimeout time.Duration
+	// WithFailoverFactory() factory, ignoring its context
+	failover metaFactory
+	// WithDialAttempts() number of factory calls per dial and
+	// WithDialBackoff() delays between them
+	dialAttempts int
+	dialBackoff  *Backoff
+	// WithMaxTotalDials() budget, 0 if unlimited, and number of
+	// successful or in progress dials, accessed atomically
+	maxTotalDials int64
+	totalDials    int64
+
+	// closed when the pool is closed to stop background goroutines
+	done chan struct{}
+	// Done() channel, closed once the pool is closed and all its
+	// rconns too
+	drained     chan struct{}
+	drainedOnce sync.Once
+
+	// wakes up the min idle maintainer
+	minIdleWake chan struct{}
+
+	logger     Logger
+	clock      clock
+	onClose    func(RpcAble)
+	onBadPut   func()
+	onGet      func(Conn, string)
+	closeFunc  func(RpcAble) error
+	fullPolicy FullPolicy
+	minIdle    int
+	// number of factory errors tolerated during the initial fill
+	fillTolerance int
+	// true if the initial fill validates the new rconns
+	fillValidation bool
+	// true if Get() never dials
+	noSyncDial bool
+	// true if the pool never dials
+	noFactory bool
+	// WithSoftCap() limit, 0 if disabled
+	softCap int64
+	// WithOverflowAllowance() setting, 0 if disabled
+	overflowAllowance int64
+	// WithPreferFreshAfter() age, 0 if disabled
+	preferFreshAfter time.Duration
+	// WithMaxCumulativeUseTime() limit, 0 if disabled
+	maxUseTime time.Duration
+	// WithEagerReplace() setting, number of idle rconns to restore
+	// when one is closed, 0 if disabled, and 1 while the replacement
+	// goroutine runs, accessed atomically
+	eagerReplace   bool
+	replaceTarget  int
+	replacing      int32
+	replacePending int32
+	// WithPingIfIdleLongerThan() idle time and ping, nil if disabled
+	pingIdleAfter time.Duration
+	pingIdle      func(RpcAble) error
+	// WithConnDecorator() function
+	decorator func(RpcAble) RpcAble
+	// WithPrime() setup, and WithRePrime() setting
+	prime   func(context.Context, RpcAble) error
+	rePrime bool
+
+	sweepInterval  time.Duration
+	sweepValidator func(RpcAble) error
+	// WithStatsLogging() interval, 0 if disabled
+	statsInterval time.Duration
+	// fraction of background loops intervals used as random jitter
+	intervalJitter float64
+
+	// WithValidator() or SetValidator() validator, as a
+	// validatorFunc, accessed atomically
+	validator    atomic.Value
+	putValidator func(RpcAble) error
+	latencyAware bool
+
+	// serializes GetN() calls, honoring their context
+	getNSem chan struct{}
+
+	// closed by Resume(), nil if the pool is not paused
+	pauseMu sync.Mutex
+	resumed chan struct{}
+
+	// WithMaxWaiters() limit, 0 if unlimited
+	maxWaiters int64
+	// WithRetireOn() predicate, nil meaning any error
+	retireOn func(error) bool
+
+	// WithSaturationCallback() settings, saturated being 1 once the
+	// threshold is crossed upward, written with saturationMu held
+	// and accessed atomically
+	saturationThreshold float64
+	onSaturation        func(saturated bool)
+	saturationMu        sync.Mutex
+	saturated           int32
+
+	// WithAsyncClose() background closing, closeQueue being nil if
+	// disabled
+	asyncClose   bool
+	closeQueue   chan *rconnEntry
+	closeMu      sync.RWMutex
+	closeStopped bool
+	closeWg      sync.WaitGroup
+	closeDone    chan struct{}
+
+	// GetForKey() preferred idle rconns
+	affinityMu sync.Mutex
+	affinity   map[string]*rconnEntry
+
+	// Events() channel, created on first call
+	eventsMu      sync.RWMutex
+	events        chan Event
+	eventsClosed  bool
+	droppedEvents int64
+}
+
+// poolState holds the rconns channel and the factory of a pool, both
+// nil once the pool is closed.
+type poolState struct {
+	rconns  chan *rconnEntry
+	factory metaFactory
 }
 
 // Factory is a function to create new RPC-able connections.
 type Factory func() (RpcAble, error)
 
+// FactoryContext is a function to create new RPC-able connections
+// honoring ctx.
+type FactoryContext func(ctx context.Context) (RpcAble, error)
+
+// FactoryWithMeta is a function to create new RPC-able connections
+// along with user metadata, returned by Conn.Meta() each time the
+// RPC-able connection is checked out.
+type FactoryWithMeta func() (RpcAble, map[string]string, error)
+
+// FactoryWithCleanup is a function to create new RPC-able
+// connections along with a cleanup function, typically releasing a
+// lease or deregistering from a discovery service. The pool calls
+// cleanup just after closing the RPC-able connection for good,
+// whatever the reason. cleanup can be nil.
+type FactoryWithCleanup func() (rconn RpcAble, cleanup func(), err error)
+
+// FactoryAttempt is a function to create new RPC-able connections
+// honoring ctx. attempt is the number of the attempt within a single
+// dial, starting at 0, see WithDialAttempts(), so the factory can pick
+// another backend than the one that just failed.
+type FactoryAttempt func(ctx context.Context, attempt int) (RpcAble, error)
+
+// metaFactory is the factory form used internally, all factories
+// being adapted to it. The returned cleanup function is the
+// FactoryWithCleanup one, nil for the other factories.
+type metaFactory func(ctx context.Context, attempt int) (rconn RpcAble, meta map[string]string, cleanup func(), err error)
+
+// rconnEntry holds an RPC-able connection created by the pool along
+// with its pool-side metadata.
+type rconnEntry struct {
+	// average call latency in nanoseconds, accessed atomically
+	avgLatency int64
+
+	rconn RpcAble
+	// owning pool
+	pool      *channelPool
+	gen       uint64
+	createdAt time.Time
+	// last time the rconn became idle
+	idleSince time.Time
+	// number of times the rconn has been checked out
+	uses int
+	// last checkout time and cumulative checkout duration, only
+	// tracked with WithMaxCumulativeUseTime()
+	checkedOutAt time.Time
+	useTime      time.Duration
+	// true if created by the failover factory
+	failover bool
+	// GetForKey() key associated to the rconn while idle
+	affinityKey string
+	// FactoryWithMeta() metadata, if any
+	meta map[string]string
+	// FactoryWithCleanup() cleanup function, if any
+	cleanup func()
+	// true if dialed by GetPriority() beyond the SetMaxOpenConns()
+	// limit
+	overflow bool
+	// true if retired as unhealthy or expired, so closing it dials a
+	// replacement, see WithEagerReplace()
+	replace bool
+	// last Call() error, as a *lastError, accessed atomically
+	lastErr atomic.Value
+}
+
+// lastError wraps an error as atomic.Value cannot store nil nor
+// values of different types.
+type lastError struct {
+	err error
+}
+
+// lastError returns the last Call() error on the rconn of e, or nil.
+func (e *rconnEntry) lastError() error {
+	if le, ok := e.lastErr.Load().(*lastError); ok {
+		return le.err
+	}
+	return nil
+}
+
 // NewChannelPool returns a new pool based on buffered channels with
 // an initial capacity and maximum capacity. Factory is used when
 // initial capacity is greater than zero to fill the pool. A zero
 // initialCap doesn't fill the Pool until a new Get() is
 // called. During a Get(), If there is no new RPC-able connection
 // available in the pool, a new RPC-able connection will be created
-// via the Factory() method.
-func NewChannelPool(initialCap, maxCap int, factory Factory) (Pool, error) {
-	if initialCap < 0 || maxCap <= 0 || initialCap > maxCap {
-		return nil, errors.New("invalid capacity settings")
+// via the Factory() method. opts can be used to tune the pool
+// behavior.
+func NewChannelPool(initialCap, maxCap int, factory Factory, opts ...Option) (Pool, error) {
+	var mf metaFactory
+	if factory != nil {
+		mf = func(context.Context, int) (RpcAble, map[string]string, func(), error) {
+			rconn, err := factory()
+			return rconn, nil, nil, err
+		}
+	}
+	return makeChannelPool(initialCap, maxCap, mf, true, opts)
+}
+
+// NewChannelPoolContext is like NewChannelPool but uses a factory
+// honoring the context passed to GetContext(). The initial fill uses
+// context.Background().
+func NewChannelPoolContext(initialCap, maxCap int, factory FactoryContext, opts ...Option) (Pool, error) {
+	var mf metaFactory
+	if factory != nil {
+		mf = func(ctx context.Context, _ int) (RpcAble, map[string]string, func(), error) {
+			rconn, err := factory(ctx)
+			return rconn, nil, nil, err
+		}
+	}
+	return makeChannelPool(initialCap, maxCap, mf, false, opts)
+}
+
+// NewChannelPoolAttempt is like NewChannelPoolContext but uses a
+// factory receiving the attempt number, see WithDialAttempts().
+func NewChannelPoolAttempt(initialCap, maxCap int, factory FactoryAttempt, opts ...Option) (Pool, error) {
+	var mf metaFactory
+	if factory != nil {
+		mf = func(ctx context.Context, attempt int) (RpcAble, map[string]string, func(), error) {
+			rconn, err := factory(ctx, attempt)
+			return rconn, nil, nil, err
+		}
 	}
+	return makeChannelPool(initialCap, maxCap, mf, false, opts)
+}
 
+// NewChannelPoolWithMeta is like NewChannelPool but uses a factory
+// returning metadata along with each RPC-able connection. The
+// metadata travels with the RPC-able connection and is returned by
+// Conn.Meta() on each checkout.
+func NewChannelPoolWithMeta(initialCap, maxCap int, factory FactoryWithMeta, opts ...Option) (Pool, error) {
+	var mf metaFactory
+	if factory != nil {
+		mf = func(context.Context, int) (RpcAble, map[string]string, func(), error) {
+			rconn, meta, err := factory()
+			return rconn, meta, nil, err
+		}
+	}
+	return makeChannelPool(initialCap, maxCap, mf, true, opts)
+}
+
+// NewChannelPoolWithCleanup is like NewChannelPool but uses a factory
+// returning a cleanup function along with each RPC-able connection,
+// called once the pool closed it for good, after its Close() method
+// or the WithCloseFunc() function.
+func NewChannelPoolWithCleanup(initialCap, maxCap int, factory FactoryWithCleanup, opts ...Option) (Pool, error) {
+	var mf metaFactory
+	if factory != nil {
+		mf = func(context.Context, int) (RpcAble, map[string]string, func(), error) {
+			rconn, cleanup, err := factory()
+			return rconn, nil, cleanup, err
+		}
+	}
+	return makeChannelPool(initialCap, maxCap, mf, true, opts)
+}
+
+// NewChannelPoolWithContext is like NewChannelPool but the pool is
+// automatically closed as soon as ctx is done. Note that ctx is not
+// passed to factory, see NewChannelPoolContext for that.
+func NewChannelPoolWithContext(ctx context.Context, initialCap, maxCap int, factory Factory, opts ...Option) (Pool, error) {
+	p, err := NewChannelPool(initialCap, maxCap, factory, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := p.(*channelPool)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-c.done:
+			// closed manually
+		}
+	}()
+	return p, nil
+}
+
+// makeChannelPool creates a new pool. legacyFactory is true if factory
+// is an adapted Factory, so ignores its context.
+func makeChannelPool(initialCap, maxCap int, factory metaFactory, legacyFactory bool, opts []Option) (Pool, error) {
+	switch {
+	case initialCap < 0:
+		return nil, fmt.Errorf("invalid capacity settings: %w (%d)", ErrInvalidInitialCap, initialCap)
+	case maxCap <= 0:
+		return nil, fmt.Errorf("invalid capacity settings: %w (%d)", ErrInvalidMaxCap, maxCap)
+	case initialCap > maxCap:
+		return nil, fmt.Errorf("invalid capacity settings: %w (%d > %d)", ErrInitialExceedsMax, initialCap, maxCap)
+	}
 	c := &channelPool{
-		rconns:  make(chan RpcAble, maxCap),
-		factory: factory,
+		initialCap:   initialCap,
+		maxCap:       maxCap,
+		maxIdle:      maxCap,
+		rconns:       make(chan *rconnEntry, maxCap),
+		factory:      factory,
+		legacy:       legacyFactory,
+		done:         make(chan struct{}),
+		drained:      make(chan struct{}),
+		getNSem:      make(chan struct{}, 1),
+		logger:       stdLogger{},
+		clock:        realClock{},
+		dialAttempts: 1,
+	}
+	c.state.Store(&poolState{rconns: c.rconns, factory: factory})
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.noFactory {
+		if initialCap > 0 {
+			return nil, fmt.Errorf("cannot fill the pool: %w", ErrNoFactory)
+		}
+		// nothing to maintain
+		c.minIdle = 0
+	} else if factory == nil {
+		return nil, errors.New("factory is nil")
+	}
+	if c.maxIdle < 0 {
+		c.maxIdle = 0
+	} else if c.maxIdle > maxCap {
+		c.maxIdle = maxCap
+	}
+	if c.minIdle > c.maxIdle {
+		// rconns above the idle cap would be closed as soon as dialed
+		c.minIdle = c.maxIdle
+	}
+	if initialCap > c.maxIdle {
+		initialCap = c.maxIdle
+	}
+	if c.eagerReplace && !c.noFactory {
+		c.replaceTarget = initialCap
+		if c.minIdle > initialCap {
+			c.replaceTarget = c.minIdle
+		}
+		// no replacement competes with the initial fill
+		c.replacing = 1
+	}
+	if c.softCap > int64(maxCap) {
+		c.softCap = int64(maxCap)
+	}
+	if c.softCap > 0 && int64(c.minIdle) > c.softCap {
+		// rconns above the soft cap would be closed as soon as dialed
+		c.minIdle = int(c.softCap)
+	}
+	if c.asyncClose {
+		c.startAsyncClose()
 	}
 
-	// create initial RPC-able connections, if something goes wrong,
-	// just close the pool error out.
+	// create initial RPC-able connections, if something goes wrong
+	// more than tolerated, just close the pool error out.
+	failures := 0
 	for i := 0; i < initialCap; i++ {
-		rconn, err := factory()
+		if !c.reserve() {
+			c.logger.Printf("pool: shared limiter reached, %d initial connections created", i)
+			break
+		}
+		e, err := c.dial(context.Background(), factory)
 		if err != nil {
-			c.Close()
-			return nil, fmt.Errorf("factory is not able to fill the pool: %s", err)
+			c.release()
+		} else if validator := c.getValidator(); c.fillValidation && validator != nil {
+			if err = c.validate(validator, e.rconn); err != nil {
+				c.closeRconn(e) // releases the reserved slot
+				err = fmt.Errorf("validation failed: %s", err)
+			}
+		}
+		if err != nil {
+			if failures++; failures > c.fillTolerance {
+				c.Close()
+				return nil, fmt.Errorf("factory is not able to fill the pool: %s", err)
+			}
+			c.logger.Printf("pool: cannot create initial connection: %s", err)
+			continue
 		}
-		c.rconns <- rconn
+		e.idleSince = e.createdAt
+		c.idle++
+		c.rconns <- e
+	}
+
+	// replacements can now start
+	atomic.StoreInt32(&c.replacing, 0)
+
+	if c.minIdle > 0 {
+		c.minIdleWake = make(chan struct{}, 1)
+		go c.maintainMinIdle()
+	}
+
+	if c.sweepInterval > 0 && c.sweepValidator != nil {
+		go c.healthSweep()
+	}
+
+	if c.statsInterval > 0 {
+		go c.statsLogging()
 	}
 
 	return c, nil
 }
 
-func (c *channelPool) getRconns() chan RpcAble {
-	c.mu.Lock()
-	rconns := c.rconns
-	c.mu.Unlock()
-	return rconns
+// maintainMinIdle keeps at least c.minIdle idle RPC-able connections
+// in the pool until it is closed.
+func (c *channelPool) maintainMinIdle() {
+	for {
+		c.fillMinIdle()
+
+		timer := c.clock.NewTimer(c.jitter(minIdleInterval))
+		select {
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-c.minIdleWake:
+			timer.Stop()
+		case <-timer.C():
+		}
+	}
+}
+
+// jitter returns d randomly shifted by up to plus or minus the
+// WithIntervalJitter() fraction of d.
+func (c *channelPool) jitter(d time.Duration) time.Duration {
+	if c.intervalJitter <= 0 {
+		return d
+	}
+	return d + time.Duration((2*rand.Float64()-1)*c.intervalJitter*float64(d))
+}
+
+// fillMinIdle dials RPC-able connections until the pool holds
+// c.minIdle idle ones. It gives up on the first factory error, the
+// next attempt occurring on the next wake up.
+func (c *channelPool) fillMinIdle() {
+	c.fillIdle(c.minIdle, "min idle")
+}
+
+// fillIdle dials RPC-able connections until the pool holds target
+// idle ones, what naming the target in logs. It gives up on the first
+// factory error or if a new RPC-able connection cannot be pooled.
+func (c *channelPool) fillIdle(target int, what string) {
+	if c.isPaused() {
+		return
+	}
+	for {
+		c.mu.Lock()
+		factory := c.factory
+		missing := c.rconns != nil && len(c.rconns) < target &&
+			len(c.rconns) < c.maxIdle
+		c.mu.Unlock()
+
+		if !missing || c.dialBudgetExhausted() || !c.reserve() {
+			return
+		}
+
+		e, err := c.dial(context.Background(), factory)
+		if err != nil {
+			c.release()
+			c.logger.Printf("pool: cannot maintain %s connections: %s", what, err)
+			return
+		}
+		if accepted, _ := c.put(e); !accepted {
+			// dialing again would not help
+			return
+		}
+	}
+}
+
+// replaceClosed dials in the background, see WithEagerReplace(), the
+// replacements of retired RPC-able connections, until the pool holds
+// again c.replaceTarget idle ones. Only one replacement goroutine runs
+// at a time, a retirement occurring meanwhile making it check the
+// target again before exiting.
+func (c *channelPool) replaceClosed() {
+	if c.replaceTarget == 0 || c.overSoftCap() {
+		return
+	}
+	atomic.StoreInt32(&c.replacePending, 1)
+	if !atomic.CompareAndSwapInt32(&c.replacing, 0, 1) {
+		return
+	}
+	go func() {
+		for {
+			atomic.StoreInt32(&c.replacePending, 0)
+			c.fillIdle(c.replaceTarget, "replacement")
+			atomic.StoreInt32(&c.replacing, 0)
+
+			// an rconn retired after the last fillIdle() check, while
+			// c.replacing was still set, has to be replaced too
+			if atomic.LoadInt32(&c.replacePending) == 0 ||
+				!atomic.CompareAndSwapInt32(&c.replacing, 0, 1) {
+				return
+			}
+		}
+	}()
+}
+
+// retire closes the RPC-able connection of e, found unhealthy or
+// expired, dialing a replacement if WithEagerReplace() is enabled.
+func (c *channelPool) retire(e *rconnEntry) error {
+	e.replace = true
+	return c.closeRconn(e)
+}
+
+// discardRetired is retire() but closes e as discard() does.
+func (c *channelPool) discardRetired(e *rconnEntry) error {
+	e.replace = true
+	return c.discard(e)
+}
+
+// badPut records a nil or mismatched RPC-able connection returned to
+// the pool, calling the WithOnBadPut() hook if any.
+func (c *channelPool) badPut() {
+	atomic.AddInt64(&c.badPuts, 1)
+	if c.onBadPut != nil {
+		c.safeCall("OnBadPut hook", c.onBadPut)
+	}
+}
+
+// closeRconn closes the RPC-able connection of e on behalf of the pool.
+func (c *channelPool) closeRconn(e *rconnEntry) error {
+	return c.closeEntry(e, true)
+}
+
+// closeEntry is closeRconn() but the slot of e is only released if
+// release is true, as it can have been released in advance.
+func (c *channelPool) closeEntry(e *rconnEntry, release bool) error {
+	atomic.AddInt64(&c.closed, 1)
+	c.trackOpen(e, -1)
+	c.forgetAffinity(e)
+	err := c.closeRpcAble(e.rconn, e.cleanup)
+	if e.overflow {
+		atomic.AddInt64(&c.numOverflow, -1)
+	}
+	if release {
+		c.release()
+	}
+	c.emit(EventClosed)
+	if c.onClose != nil {
+		c.safeCall("OnClose hook", func() { c.onClose(e.rconn) })
+	}
+	if e.replace {
+		c.replaceClosed()
+	}
+	return err
+}
+
+// closeRpcAble closes rconn using the WithCloseFunc() function if
+// any, or its Close() method, then calls cleanup if not nil. If rconn
+// is Drainable, it is drained first, a drain error being logged but
+// not preventing the close. A panic in the WithCloseFunc() function is
+// recovered and returned as an error.
+func (c *channelPool) closeRpcAble(rconn RpcAble, cleanup func()) (err error) {
+	if cleanup != nil {
+		// deferred first, so called last, whatever the close outcome
+		defer c.safeCall("cleanup func", cleanup)
+	}
+
+	if d, ok := rconn.(Drainable); ok {
+		if err := d.Drain(); err != nil {
+			c.logger.Printf("pool: cannot drain connection: %s", err)
+		}
+	}
+
+	if c.closeFunc == nil {
+		return rconn.Close()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Printf("pool: close func panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("close func panicked: %v", r)
+		}
+	}()
+	return c.closeFunc(rconn)
+}
+
+// validate calls the user validator fn against rconn. A panic in fn
+// is recovered and reported as a validation failure.
+func (c *channelPool) validate(fn func(RpcAble) error, rconn RpcAble) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Printf("pool: validator panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("validator panicked: %v", r)
+		}
+	}()
+	return fn(rconn)
+}
+
+// safeCall calls the user callback fn, recovering and logging any
+// panic so a buggy callback cannot crash the calling goroutine.
+func (c *channelPool) safeCall(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Printf("pool: %s panicked: %v\n%s", name, r, debug.Stack())
+		}
+	}()
+	fn()
+}
+
+// healthSweep periodically validates idle RPC-able connections until
+// the pool is closed.
+func (c *channelPool) healthSweep() {
+	for {
+		timer := c.clock.NewTimer(c.jitter(c.sweepInterval))
+		select {
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-timer.C():
+			c.sweep()
+		}
+	}
+}
+
+// statsLogging periodically logs the pool statistics until the pool
+// is closed.
+func (c *channelPool) statsLogging() {
+	for {
+		timer := c.clock.NewTimer(c.jitter(c.statsInterval))
+		select {
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-timer.C():
+			c.logStats()
+		}
+	}
+}
+
+// logStats logs the pool statistics on one line of key=value pairs.
+func (c *channelPool) logStats() {
+	s := c.Stats()
+	c.logger.Printf("pool: stats open=%d idle=%d in_use=%d waiters=%d waits=%d exhausted=%d created=%d closed=%d dial_error_rate=%.3f",
+		s.Open, s.Idle, s.InUse, s.Waiters, s.WaitCount, s.ExhaustedCount,
+		s.Created, s.Closed, s.DialErrorRate)
+}
+
+// sweep validates each idle RPC-able connection once, closing the
+// ones failing validation and putting back the others.
+func (c *channelPool) sweep() {
+	if c.isPaused() {
+		return
+	}
+	c.validateIdle(c.sweepValidator)
+}
+
+// validateIdle validates each idle RPC-able connection once against
+// validate, closing the ones failing validation and putting back the
+// others. It returns the number of closed ones.
+func (c *channelPool) validateIdle(validate func(RpcAble) error) int {
+	closed := 0
+	rconns := c.getRconns()
+	for n := len(rconns); n > 0; n-- {
+		var e *rconnEntry
+		select {
+		case e = <-rconns:
+		default:
+			// emptied in the meantime by concurrent Get() calls
+			return closed
+		}
+		if e == nil {
+			// pool is closed
+			return closed
+		}
+		atomic.AddInt64(&c.idle, -1)
+
+		if err := c.validate(validate, e.rconn); err != nil {
+			c.emit(EventReaped)
+			c.retire(e)
+			closed++
+			continue
+		}
+		c.requeue(e, false)
+	}
+	return closed
+}
+
+// Flush implements the Pool interfaces Flush() method.
+func (c *channelPool) Flush(validate func(RpcAble) error) int {
+	closed := c.validateIdle(validate)
+
+	_, factory, err := c.snapshot()
+	if err != nil {
+		return 0
+	}
+	replaced := 0
+	for ; replaced < closed && c.reserve(); replaced++ {
+		e, err := c.dial(context.Background(), factory)
+		if err != nil {
+			c.release()
+			c.logger.Printf("pool: cannot replace flushed connection: %s", err)
+			break
+		}
+		c.put(e)
+	}
+	return replaced
+}
+
+// snapshot returns rconns and factory read at once without locking,
+// as Close() resets both. It returns ErrClosed if the pool is closed.
+func (c *channelPool) snapshot() (chan *rconnEntry, metaFactory, error) {
+	s := c.state.Load().(*poolState)
+	if s.rconns == nil {
+		return nil, nil, ErrClosed
+	}
+	return s.rconns, s.factory, nil
+}
+
+// getRconns returns the rconns channel without locking, nil if the
+// pool is closed.
+func (c *channelPool) getRconns() chan *rconnEntry {
+	return c.state.Load().(*poolState).rconns
 }
 
 // Get implements the Pool interfaces Get() method. If there is no new
 // RPC-able connection available in the pool, a new RPC-able
 // connection will be created via the Factory() method.
-func (c *channelPool) Get() (RpcAble, error) {
-	rconns := c.getRconns()
-	if rconns == nil {
+func (c *channelPool) Get() (Conn, error) {
+	return c.get(context.Background(), nil, false)
+}
+
+// GetContext implements the Pool interfaces GetContext() method.
+func (c *channelPool) GetContext(ctx context.Context) (Conn, error) {
+	return c.get(ctx, nil, false)
+}
+
+// GetPriority implements the Pool interfaces GetPriority() method.
+func (c *channelPool) GetPriority(ctx context.Context) (Conn, error) {
+	return c.get(ctx, nil, true)
+}
+
+// labelKey is the context key of the GetLabeled() label, passed to
+// get() this way.
+type labelKey struct{}
+
+// GetLabeled implements the Pool interfaces GetLabeled() method.
+func (c *channelPool) GetLabeled(ctx context.Context, label string) (Conn, error) {
+	return c.get(context.WithValue(ctx, labelKey{}, label), nil, false)
+}
+
+// GetValidated implements the Pool interfaces GetValidated() method.
+func (c *channelPool) GetValidated(validate func(RpcAble) bool) (Conn, error) {
+	return c.get(context.Background(), validate, false)
+}
+
+// Borrow implements the Pool interfaces Borrow() method.
+func (c *channelPool) Borrow() (RpcAble, func(), error) {
+	rconn, err := c.get(context.Background(), nil, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a second rconn.Close() is harmless, the wrapper being detached
+	return rconn, func() {
+		// recover() only stops a panic if release is directly deferred
+		if r := recover(); r != nil {
+			rconn.MarkUnusable()
+			rconn.Close()
+			panic(r)
+		}
+		rconn.Close()
+	}, nil
+}
+
+// GetN implements the Pool interfaces GetN() method.
+func (c *channelPool) GetN(ctx context.Context, n int) ([]RpcAble, error) {
+	if n <= 0 || n > c.maxCap {
+		return nil, fmt.Errorf("cannot get %d connections from a pool of maximum capacity %d", n, c.maxCap)
+	}
+	// otherwise, waiting for the last ones would never end
+	if max := atomic.LoadInt64(&c.maxOpen); max > 0 && int64(n) > max {
+		return nil, fmt.Errorf("cannot get %d connections from a pool of at most %d open connections", n, max)
+	}
+
+	select {
+	case c.getNSem <- struct{}{}:
+		defer func() { <-c.getNSem }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
 		return nil, ErrClosed
 	}
 
+	rconns := make([]RpcAble, 0, n)
+	for len(rconns) < n {
+		rconn, err := c.get(ctx, nil, false)
+		if err != nil {
+			for _, rconn := range rconns {
+				rconn.Close()
+			}
+			return nil, err
+		}
+		rconns = append(rconns, rconn)
+	}
+	return rconns, nil
+}
+
+// WithConn implements the Pool interfaces WithConn() method.
+func (c *channelPool) WithConn(fn func(RpcAble) error) error {
+	return c.withConn(fn, nil)
+}
+
+// WithConnRetry implements the Pool interfaces WithConnRetry() method.
+func (c *channelPool) WithConnRetry(attempts int, retriable func(error) bool, fn func(RpcAble) error) error {
+	if retriable == nil {
+		retriable = isShutdown
+	}
+	for {
+		attempts--
+		err := c.withConn(fn, retriable)
+		if err == nil || attempts <= 0 || !retriable(err) {
+			return err
+		}
+	}
+}
+
+// withConn gets an rconn, calls fn with it and returns fn error. The
+// rconn is closed if the error is retiring or retriable, put back to
+// the pool otherwise.
+func (c *channelPool) withConn(fn func(RpcAble) error, retriable func(error) bool) error {
+	rconn, err := c.get(context.Background(), nil, false)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			// fn panicked, the state of the rconn is unknown
+			rconn.MarkUnusable()
+			rconn.Close()
+			panic(r)
+		}
+	}()
+
+	err = fn(rconn)
+	if err != nil && (c.retireOn == nil || c.retireOn(err) ||
+		retriable != nil && retriable(err)) {
+		rconn.MarkUnusable()
+	}
+	rconn.Close()
+	return err
+}
+
+// CallChecked implements the Pool interfaces CallChecked() method.
+func (c *channelPool) CallChecked(serviceMethod string, args, reply interface{}, ok func(reply interface{}) bool) error {
+	return c.withConn(func(rconn RpcAble) error {
+		if err := rconn.Call(serviceMethod, args, reply); err != nil {
+			return err
+		}
+		if ok != nil && !ok(reply) {
+			return ErrBadReply
+		}
+		return nil
+	}, func(err error) bool { return err == ErrBadReply })
+}
+
+// isShutdown returns true if err means the RPC-able connection is
+// shut down.
+func isShutdown(err error) bool {
+	return errors.Is(err, rpc.ErrShutdown) || errors.Is(err, io.EOF)
+}
+
+// GoAndRelease implements the Pool interfaces GoAndRelease() method.
+func (c *channelPool) GoAndRelease(serviceMethod string, args, reply interface{}) <-chan error {
+	errc := make(chan error, 1)
+
+	rconn, err := c.get(context.Background(), nil, false)
+	if err != nil {
+		errc <- err
+		return errc
+	}
+
+	call := rconn.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1))
+	go func() {
+		<-call.Done
+		// the call is over, the rconn can be reused
+		rconn.Close()
+		errc <- call.Error
+	}()
+	return errc
+}
+
+// get returns an idle RPC-able connection passing the pool validator
+// and validate if not nil, closing the failing ones. If there is no
+// such RPC-able connection available in the pool, a new RPC-able
+// connection will be created via the Factory() method, using ctx. If
+// priority is true, the WithOverflowAllowance() RPC-able connections
+// can be dialed instead of waiting.
+func (c *channelPool) get(ctx context.Context, validate func(RpcAble) bool, priority bool) (Conn, error) {
+	rconns, factory, err := c.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// wrap our rconns with out custom RpcAble implementation (wrapRconn
 	// method) that puts the RPC-able connection back to the pool if it's closed.
+	waited, queued := false, false
+	defer func() {
+		if queued {
+			atomic.AddInt64(&c.waiters, -1)
+		}
+	}()
+	// number of idle rconns rejected by usable(), bounded so Get()
+	// cannot spin while unhealthy rconns keep being returned
+	rejected := 0
+	label, _ := ctx.Value(labelKey{}).(string)
+	for {
+		// get the change notification channel before looking for an
+		// idle rconn, so no change can be missed
+		var changed, limited <-chan struct{}
+		if atomic.LoadInt64(&c.maxOpen) > 0 || c.limiter != nil || c.maxTotalDials > 0 {
+			changed = c.changes()
+		}
+		if c.limiter != nil {
+			limited = c.limiter.changes()
+		}
+
+		e, err := c.next(rconns)
+		if err != nil {
+			return nil, err
+		}
+
+		if e == nil {
+			if c.noSyncDial || c.noFactory {
+				c.wakeMinIdle()
+				return nil, ErrNoIdle
+			}
+
+			exhausted := c.dialBudgetExhausted()
+			if exhausted && atomic.LoadInt64(&c.numOpen) == 0 {
+				// no rconn left to reuse
+				return nil, ErrDialBudgetExhausted
+			}
+
+			reserved, overflow := !exhausted && c.reserve(), false
+			if !reserved && !exhausted && priority && c.overflowAllowance > 0 {
+				if overflow = c.reserveOver(c.overflowAllowance); overflow {
+					atomic.AddInt64(&c.numOverflow, 1)
+				}
+			}
+
+			if !reserved && !overflow {
+				// too many open rconns or no dial left, wait for one to
+				// be returned or closed
+				if !waited {
+					waited = true
+					atomic.AddInt64(&c.waitCount, 1)
+				}
+				if !queued {
+					if !c.enqueue() {
+						atomic.AddInt64(&c.exhausted, 1)
+						return nil, ErrPoolExhausted
+					}
+					queued = true
+				}
+				if changed != nil {
+					if err := c.wait(ctx, changed, limited); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+
+			if !waited {
+				atomic.AddInt64(&c.waitCount, 1)
+			}
+
+			e, err := c.dial(ctx, factory)
+			if err != nil {
+				if overflow {
+					atomic.AddInt64(&c.numOverflow, -1)
+				}
+				c.release()
+				return nil, err
+			}
+			// an overflow rconn is closed instead of being pooled
+			e.overflow = overflow
+
+			return c.wrapRconn(e, label), nil
+		}
+
+		if !c.usable(ctx, e, validate) {
+			if rejected++; rejected > c.maxCap {
+				return nil, ErrNoHealthyConn
+			}
+			continue
+		}
+
+		return c.wrapRconn(e, label), nil
+	}
+}
+
+// admit checks a checkout can proceed: the pool must not be closed
+// nor ctx done, and a paused pool is waited for to be resumed. It
+// returns the rconns channel and the factory to use.
+func (c *channelPool) admit(ctx context.Context) (chan *rconnEntry, metaFactory, error) {
+	rconns, factory, err := c.snapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.waitResumed(ctx); err != nil {
+		return nil, nil, err
+	}
+	return rconns, factory, nil
+}
+
+// wakeMinIdle wakes up the min idle maintainer if the pool holds
+// fewer than c.minIdle idle rconns.
+func (c *channelPool) wakeMinIdle() {
+	if c.minIdleWake != nil && c.Len() < c.minIdle {
+		select {
+		case c.minIdleWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// usable checks the idle rconn of e just taken from the pool can be
+// handed out, closing it if not. It also wakes up the min idle
+// maintainer if needed.
+func (c *channelPool) usable(ctx context.Context, e *rconnEntry, validate func(RpcAble) bool) bool {
+	now := c.clock.Now()
+	if c.expired(e, now) {
+		atomic.AddInt64(&c.maxLifetimeClosed, 1)
+		c.emit(EventReaped)
+		c.retire(e)
+		return false
+	}
+
+	if c.preferFresh(e, now) {
+		c.emit(EventReaped)
+		c.closeRconn(e)
+		return false
+	}
+
+	c.wakeMinIdle()
+
+	if c.pingIdle != nil && now.Sub(e.idleSince) >= c.pingIdleAfter &&
+		c.validate(c.pingIdle, e.rconn) != nil {
+		c.emit(EventDiscarded)
+		c.retire(e)
+		return false
+	}
+
+	if !c.isValid(e, validate) {
+		c.emit(EventDiscarded)
+		c.retire(e)
+		return false
+	}
+
+	if c.rePrime && c.prime != nil {
+		if err := c.callPrime(ctx, e.rconn); err != nil {
+			c.logger.Printf("pool: cannot re-prime connection: %s", err)
+			c.emit(EventDiscarded)
+			c.retire(e)
+			return false
+		}
+	}
+	return true
+}
+
+// wait waits for changed or limited to be closed, limited being
+// possibly nil. It returns ctx.Err() if ctx is done before, and
+// ErrClosed if the pool is closed.
+func (c *channelPool) wait(ctx context.Context, changed, limited <-chan struct{}) error {
 	select {
-	case rconn := <-rconns:
-		if rconn == nil {
+	case <-changed:
+		return nil
+	case <-limited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+// next removes from rconns the next idle rconn to hand out. It
+// returns nil if there is no idle rconn, and ErrClosed if the pool is
+// closed.
+func (c *channelPool) next(rconns chan *rconnEntry) (*rconnEntry, error) {
+	if c.latencyAware {
+		return c.takeFastest()
+	}
+
+	select {
+	case e := <-rconns:
+		if e == nil {
 			return nil, ErrClosed
 		}
-
-		return c.wrapRconn(rconn), nil
+		atomic.AddInt64(&c.idle, -1)
+		return e, nil
 	default:
-		rconn, err := c.factory()
+		return nil, nil
+	}
+}
+
+// isValid returns true if the RPC-able connection of e passes the
+// pool validator and validate if not nil.
+func (c *channelPool) isValid(e *rconnEntry, validate func(RpcAble) bool) bool {
+	if validator := c.getValidator(); validator != nil && c.validate(validator, e.rconn) != nil {
+		return false
+	}
+	if validate != nil {
+		err := c.validate(func(rconn RpcAble) error {
+			if !validate(rconn) {
+				return errInvalid
+			}
+			return nil
+		}, e.rconn)
 		if err != nil {
-			return nil, err
+			return false
 		}
+	}
+	return true
+}
+
+// put puts the rconn of e back to the pool. If the pool is full or
+// closed, if the rconn was created before the last Reset() or exceeds
+// its maximum lifetime, or if too many rconns are open, rconn is
+// simply closed. A nil rconn will be rejected. It returns true if the
+// rconn went back to the idle rconns.
+func (c *channelPool) put(e *rconnEntry) (bool, error) {
+	if e != nil {
+		e.idleSince = c.clock.Now()
 
-		return c.wrapRconn(rconn), nil
+		// validate without holding the lock, the check can be slow
+		if c.putValidator != nil && e.pool == c && e.rconn != nil &&
+			c.validate(c.putValidator, e.rconn) != nil {
+			c.emit(EventDiscarded)
+			return false, c.discardRetired(e)
+		}
 	}
+	return c.requeue(e, c.returnToFront)
 }
 
-// put puts the rconn back to the pool. If the pool is full or closed,
-// rconn is simply closed. A nil rconn will be rejected.
-func (c *channelPool) put(rconn RpcAble) error {
-	if rconn == nil {
-		return errors.New("rconn is nil. rejecting")
+// requeue is like put() but keeps the last time e became idle, for
+// rconns taken out of the pool without being used. If front is true,
+// e is put at the front of the idle rconns instead of the back.
+func (c *channelPool) requeue(e *rconnEntry, front bool) (bool, error) {
+	if e == nil || e.rconn == nil {
+		c.badPut()
+		return false, errors.New("rconn is nil. rejecting")
+	}
+
+	if e.pool != c {
+		c.badPut()
+		// close it on behalf of its owning pool to keep its
+		// statistics right
+		e.pool.closeRconn(e)
+		return false, errWrongPool
+	}
+
+	if e.gen != atomic.LoadUint64(&c.gen) {
+		// rconn is outdated, close it
+		c.emit(EventDiscarded)
+		return false, c.discard(e)
+	}
+
+	if c.expired(e, c.clock.Now()) {
+		atomic.AddInt64(&c.maxLifetimeClosed, 1)
+		c.emit(EventReaped)
+		return false, c.discardRetired(e)
+	}
+
+	if e.overflow {
+		// dialed by GetPriority() beyond the open limit
+		return false, c.discard(e)
 	}
 
+	if c.overOpen() {
+		// SetMaxOpenConns() lowered the limit, let checked-out rconns
+		// drain
+		return false, c.discard(e)
+	}
+
+	if c.overSoftCap() {
+		// overflow rconn dialed during a burst
+		return false, c.discard(e)
+	}
+
+	ok, evicted, err := c.offer(e, front)
+	if err != nil {
+		// pool is closed, close passed rconn
+		return false, c.closeRconn(e)
+	}
+	if evicted != nil {
+		atomic.AddInt64(&c.maxIdleClosed, 1)
+		return true, c.discard(evicted)
+	}
+	if !ok {
+		// pool is full, close passed rconn
+		atomic.AddInt64(&c.maxIdleClosed, 1)
+		return false, c.discard(e)
+	}
+	return true, nil
+}
+
+// offer locks the pool and pushes e into the idle channel, see
+// push() and pushFront(). Rconns to close are left to the caller, so a
+// slow close doesn't hold the lock. It returns ErrClosed if the pool
+// is closed.
+func (c *channelPool) offer(e *rconnEntry, front bool) (bool, *rconnEntry, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.rconns == nil {
-		// pool is closed, close passed rconn
-		return rconn.Close()
+		return false, nil, ErrClosed
+	}
+	if front {
+		ok, evicted := c.pushFront(e)
+		return ok, evicted, nil
 	}
+	ok, evicted := c.push(e)
+	return ok, evicted, nil
+}
 
-	// put the resource back into the pool. If the pool is full, this will
-	// block and the default case will be executed.
-	select {
-	case c.rconns <- rconn:
+// push puts e into the idle channel, depending on the full
+// policy. It returns false if the pool is full and e has not been
+// put. If an idle rconn has been evicted to make room for e, it is
+// returned and has to be closed by the caller. c.mu must be held
+// and the pool must not be closed.
+func (c *channelPool) push(e *rconnEntry) (bool, *rconnEntry) {
+	// As sends to the channel always occur with the lock held and
+	// c.maxIdle is lower or equal to its capacity, the sends below
+	// never block.
+	if len(c.rconns) < c.maxIdle {
+		atomic.AddInt64(&c.idle, 1)
+		c.rconns <- e
+		c.notify()
+		return true, nil
+	}
+
+	if c.fullPolicy == FullPolicyEvictOldest && c.maxIdle > 0 {
+		// pool is full, evict the oldest idle rconn which is the next
+		// one to be received from the channel.
+		atomic.AddInt64(&c.idle, 1)
+		select {
+		case oldest := <-c.rconns:
+			atomic.AddInt64(&c.idle, -1)
+			c.rconns <- e
+			c.notify()
+			return true, oldest
+		default:
+			// emptied in the meantime by concurrent Get() calls
+			c.rconns <- e
+			c.notify()
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// pushFront is like push() but puts e at the front of the idle
+// channel, so it is the next one handed out. As a channel cannot be
+// prepended, e is put at the back and the idle rconns ahead of it are
+// rotated behind it, one at a time, so the channel never looks empty
+// to concurrent Get() calls. If the pool is full, each idle rconn
+// takes the place of the next one instead, the one at the back, the
+// oldest one, being evicted. Concurrent Get() calls taking idle rconns
+// meanwhile can leave e short of the front. c.mu must be held and the
+// pool must not be closed.
+func (c *channelPool) pushFront(e *rconnEntry) (bool, *rconnEntry) {
+	full := len(c.rconns) >= c.maxIdle
+	if full && (c.fullPolicy != FullPolicyEvictOldest || c.maxIdle == 0) {
+		return false, nil
+	}
+
+	// As for push(), the sends below never block
+	atomic.AddInt64(&c.idle, 1)
+	n := len(c.rconns)
+	var carry *rconnEntry
+	if full {
+		carry = e
+	} else {
+		c.rconns <- e
+	}
+	for ; n > 0; n-- {
+		select {
+		case o := <-c.rconns:
+			if carry != nil {
+				c.rconns <- carry
+				carry = o
+				continue
+			}
+			c.rconns <- o
+			if o != e {
+				continue
+			}
+			// all rconns ahead of e taken by concurrent Get() calls
+		default:
+			// emptied in the meantime by concurrent Get() calls
+		}
+		break
+	}
+
+	var evicted *rconnEntry
+	if carry != nil {
+		if len(c.rconns) < c.maxIdle {
+			// room made in the meantime by concurrent Get() calls
+			c.rconns <- carry
+		} else {
+			atomic.AddInt64(&c.idle, -1)
+			evicted = carry
+		}
+	}
+	c.notify()
+	return true, evicted
+}
+
+// Put implements the Pool interfaces Put() method.
+func (c *channelPool) Put(rconn RpcAble) error {
+	if rconn == nil {
+		c.badPut()
+		return errors.New("rconn is nil. rejecting")
+	}
+
+	if p, ok := rconn.(*PoolRconn); ok {
+		if p.c != c {
+			// checked out from another pool, leave it to its owner,
+			// or already returned
+			c.badPut()
+			return errWrongPool
+		}
+		// checked out from this pool, simply return it
+		return p.Close()
+	}
+
+	if c.limiter != nil && !c.limiter.acquire() {
+		// no room left across the pools sharing the limiter
+		atomic.AddInt64(&c.maxIdleClosed, 1)
+		c.closeRpcAble(rconn, nil)
+		return ErrFull
+	}
+
+	// from now rconn is owned by the pool
+	atomic.AddInt64(&c.created, 1)
+	atomic.AddInt64(&c.numOpen, 1)
+	c.emit(EventCreated)
+	e := &rconnEntry{
+		rconn:     rconn,
+		pool:      c,
+		gen:       atomic.LoadUint64(&c.gen),
+		createdAt: c.clock.Now(),
+	}
+	e.idleSince = e.createdAt
+	c.trackOpen(e, 1)
+	c.noteIdleTTL(rconn)
+
+	ok, evicted, err := c.offer(e, false)
+	if err != nil {
+		c.closeRconn(e)
+		return err
+	}
+	if evicted != nil {
+		atomic.AddInt64(&c.maxIdleClosed, 1)
+		c.discard(evicted)
+	}
+	if !ok {
+		atomic.AddInt64(&c.maxIdleClosed, 1)
+		c.discard(e)
+		return ErrFull
+	}
+	return nil
+}
+
+// takeIdle removes up to max idle rconns from the pool and returns
+// them. It returns fewer rconns if the pool has fewer idle ones or is
+// closed.
+func (c *channelPool) takeIdle(max int) []*rconnEntry {
+	rconns := c.getRconns()
+
+	var idle []*rconnEntry
+	for len(idle) < max {
+		var e *rconnEntry
+		select {
+		case e = <-rconns:
+		default:
+		}
+		if e == nil {
+			// pool is empty or closed
+			break
+		}
+		atomic.AddInt64(&c.idle, -1)
+		idle = append(idle, e)
+	}
+	return idle
+}
+
+// rotate calls keep for each idle rconn, in order, removing from the
+// pool and returning the ones for which it returns false. The relative
+// order of the kept rconns is preserved. c.mu must be held.
+func (c *channelPool) rotate(keep func(*rconnEntry) bool) []*rconnEntry {
+	if c.rconns == nil {
 		return nil
-	default:
-		// pool is full, close passed rconn
-		return rconn.Close()
 	}
+
+	// rotate the whole channel. As sends to the channel always occur
+	// with the lock held, sends never block
+	var removed []*rconnEntry
+	for n := len(c.rconns); n > 0; n-- {
+		select {
+		case e := <-c.rconns:
+			if keep(e) {
+				c.rconns <- e
+			} else {
+				atomic.AddInt64(&c.idle, -1)
+				removed = append(removed, e)
+			}
+		default:
+			// emptied in the meantime by concurrent Get() calls
+			return removed
+		}
+	}
+	return removed
+}
+
+// Reset implements the Pool interfaces Reset() method.
+func (c *channelPool) Reset() error {
+	c.mu.Lock()
+	if c.rconns == nil {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+
+	// outdate all existing rconns, including checked-out ones
+	atomic.AddUint64(&c.gen, 1)
+	factory := c.factory
+
+	var idle []*rconnEntry
+	for len(c.rconns) > 0 {
+		select {
+		case e := <-c.rconns:
+			atomic.AddInt64(&c.idle, -1)
+			idle = append(idle, e)
+		default:
+			// emptied in the meantime by concurrent Get() calls
+		}
+	}
+	c.mu.Unlock()
+
+	for _, e := range idle {
+		c.closeRconn(e)
+	}
+
+	for i := 0; i < c.initialCap && c.reserve(); i++ {
+		e, err := c.dial(context.Background(), factory)
+		if err != nil {
+			c.release()
+			return fmt.Errorf("factory is not able to refill the pool: %s", err)
+		}
+		c.put(e)
+	}
+	return nil
+}
+
+// SwapConnections implements the Pool interfaces SwapConnections()
+// method.
+func (c *channelPool) SwapConnections(rconns []RpcAble) error {
+	for _, rconn := range rconns {
+		if rconn == nil {
+			return errors.New("rconn is nil. rejecting")
+		}
+		if _, ok := rconn.(*PoolRconn); ok {
+			return errors.New("rconn is checked out from a pool. rejecting")
+		}
+	}
+
+	c.mu.Lock()
+	if c.rconns == nil {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if len(rconns) > c.maxIdle {
+		c.mu.Unlock()
+		return ErrFull
+	}
+
+	// outdate all existing rconns, including checked-out ones
+	gen := atomic.AddUint64(&c.gen, 1)
+
+	// release the slots of the old idle rconns before taking the new
+	// ones, so a shared limiter doesn't see both sets at once
+	var old []*rconnEntry
+	for len(c.rconns) > 0 {
+		select {
+		case e := <-c.rconns:
+			atomic.AddInt64(&c.idle, -1)
+			c.release()
+			old = append(old, e)
+		default:
+			// emptied in the meantime by concurrent Get() calls
+		}
+	}
+
+	now := c.clock.Now()
+	var rejected []RpcAble
+	for _, rconn := range rconns {
+		if c.limiter != nil && !c.limiter.acquire() {
+			rejected = append(rejected, rconn)
+			continue
+		}
+		atomic.AddInt64(&c.created, 1)
+		atomic.AddInt64(&c.numOpen, 1)
+		e := &rconnEntry{
+			rconn:     rconn,
+			pool:      c,
+			gen:       gen,
+			createdAt: now,
+			idleSince: now,
+		}
+		c.trackOpen(e, 1)
+		// cannot block, as the channel has just been emptied
+		atomic.AddInt64(&c.idle, 1)
+		c.rconns <- e
+	}
+	c.notify()
+	c.mu.Unlock()
+
+	for _, rconn := range rconns {
+		c.noteIdleTTL(rconn)
+	}
+	for range rconns[len(rejected):] {
+		c.emit(EventCreated)
+	}
+	for _, e := range old {
+		c.closeEntry(e, false)
+	}
+	if len(rejected) > 0 {
+		atomic.AddInt64(&c.maxIdleClosed, int64(len(rejected)))
+		for _, rconn := range rejected {
+			c.closeRpcAble(rconn, nil)
+		}
+		return ErrFull
+	}
+	return nil
 }
 
-func (c *channelPool) Close() {
+// Grow implements the Pool interfaces Grow() method.
+func (c *channelPool) Grow(n int) error {
+	rconns, factory, err := c.snapshot()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	room := c.maxIdle - len(rconns)
+	c.mu.Unlock()
+	if n > room {
+		n = room
+	}
+
+	for i := 0; i < n && c.reserve(); i++ {
+		e, err := c.dial(context.Background(), factory)
+		if err != nil {
+			c.release()
+			return fmt.Errorf("factory is not able to grow the pool: %s", err)
+		}
+		c.put(e)
+	}
+	return nil
+}
+
+// Shrink implements the Pool interfaces Shrink() method.
+func (c *channelPool) Shrink(n int) int {
+	idle := c.takeIdle(n)
+	for _, e := range idle {
+		c.closeRconn(e)
+	}
+	return len(idle)
+}
+
+// Close implements the Pool interfaces Close() method.
+func (c *channelPool) Close() error {
+	return c.shutdown(context.Background(), false)
+}
+
+// CloseContext implements the Pool interfaces CloseContext() method.
+func (c *channelPool) CloseContext(ctx context.Context) error {
+	return c.shutdown(ctx, true)
+}
+
+// shutdown closes the pool and its idle rconns, concurrently if
+// concurrent is true, sequentially otherwise. It returns a
+// *CloseError as soon as ctx is done, ErrAlreadyClosed if the pool
+// was already closed, and the idle rconns close errors otherwise.
+func (c *channelPool) shutdown(ctx context.Context, concurrent bool) error {
 	c.mu.Lock()
 	rconns := c.rconns
 	c.rconns = nil
 	c.factory = nil
+	c.state.Store(&poolState{})
 	c.mu.Unlock()
 
 	if rconns == nil {
-		return
+		return ErrAlreadyClosed
 	}
 
+	close(c.done)
+	// no send can occur anymore, as c.rconns is nil, see its doc
 	close(rconns)
-	for rconn := range rconns {
-		rconn.Close()
+	c.checkDrained()
+	c.stopAsyncClose()
+
+	c.affinityMu.Lock()
+	c.affinity = nil
+	c.affinityMu.Unlock()
+
+	var idle []*rconnEntry
+	for e := range rconns {
+		atomic.AddInt64(&c.idle, -1)
+		idle = append(idle, e)
+	}
+
+	defer c.closeEvents()
+
+	var errs MultiError
+	if !concurrent {
+		for _, e := range idle {
+			if err := c.closeRconn(e); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		idle = nil
+	}
+
+	// close idle rconns concurrently, so a blocking one doesn't delay
+	// the others
+	type result struct {
+		i   int
+		err error
+	}
+	results := make(chan result, len(idle))
+	for i, e := range idle {
+		go func(i int, e *rconnEntry) {
+			results <- result{i: i, err: c.closeRconn(e)}
+		}(i, e)
+	}
+
+	closed := make([]bool, len(idle))
+	for n := 0; n < len(idle); n++ {
+		select {
+		case res := <-results:
+			closed[res.i] = true
+			if res.err != nil {
+				errs = append(errs, res.err)
+			}
+		case <-ctx.Done():
+			err := &CloseError{Err: ctx.Err()}
+			for i, e := range idle {
+				if !closed[i] {
+					err.Pending = append(err.Pending, e.rconn)
+				}
+			}
+			return err
+		}
+	}
+
+	// wait for the RPC-able connections closed in the background
+	if c.closeDone != nil {
+		select {
+		case <-c.closeDone:
+		case <-ctx.Done():
+			return &CloseError{Err: ctx.Err()}
+		}
+	}
+
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// Len implements the Pool interfaces Len() method. It doesn't lock the
+// pool.
+func (c *channelPool) Len() int { return int(atomic.LoadInt64(&c.idle)) }
+
+// Done implements the Pool interfaces Done() method.
+func (c *channelPool) Done() <-chan struct{} {
+	return c.drained
+}
+
+// IsClosed implements the Pool interfaces IsClosed() method.
+func (c *channelPool) IsClosed() bool {
+	return c.getRconns() == nil
+}
+
+// WaitUntilReady implements the Pool interfaces WaitUntilReady()
+// method.
+func (c *channelPool) WaitUntilReady(ctx context.Context, minIdle int) error {
+	for {
+		// get the change notification channel before checking the
+		// idle count, so no change can be missed
+		changed := c.changes()
+		if c.IsClosed() {
+			return ErrClosed
+		}
+		if c.Len() >= minIdle {
+			return nil
+		}
+		if err := c.wait(ctx, changed, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// HasIdle implements the Pool interfaces HasIdle() method.
+func (c *channelPool) HasIdle() bool {
+	rconns := c.getRconns()
+	return rconns != nil && len(rconns) > 0
+}
+
+// Available implements the Pool interfaces Available() method.
+func (c *channelPool) Available() int {
+	if c.getRconns() == nil {
+		return 0
+	}
+	limit := c.maxCap
+	if max := int(atomic.LoadInt64(&c.maxOpen)); max > 0 && max < limit {
+		limit = max
+	}
+	if n := limit - int(atomic.LoadInt64(&c.inUse)); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// String implements the fmt.Stringer interface.
+func (c *channelPool) String() string {
+	stats := c.Stats()
+	return fmt.Sprintf("ChannelPool{idle=%d, inUse=%d, max=%d, closed=%t}",
+		stats.Idle, stats.InUse, stats.MaxCap, c.IsClosed())
+}
+
+// Stats implements the Pool interfaces Stats() method.
+func (c *channelPool) Stats() Stats {
+	gen := atomic.LoadUint64(&c.gen)
+	return Stats{
+		Created:        atomic.LoadInt64(&c.created),
+		Closed:         atomic.LoadInt64(&c.closed),
+		WaitCount:      atomic.LoadInt64(&c.waitCount),
+		ExhaustedCount: atomic.LoadInt64(&c.exhausted),
+		BadPuts:        atomic.LoadInt64(&c.badPuts),
+		DroppedEvents:  atomic.LoadInt64(&c.droppedEvents),
+
+		MaxIdleClosed:     atomic.LoadInt64(&c.maxIdleClosed),
+		IdleTimeoutClosed: atomic.LoadInt64(&c.idleTimeoutClosed),
+		MaxLifetimeClosed: atomic.LoadInt64(&c.maxLifetimeClosed),
+		FailoverCreated:   atomic.LoadInt64(&c.failoverCreated),
+
+		AvgLatency:    time.Duration(atomic.LoadInt64(&c.avgLatency)),
+		DialErrorRate: math.Float64frombits(atomic.LoadUint64(&c.dialErrorRate)),
+		MaxCap:        c.maxCap,
+		Open:          int(atomic.LoadInt64(&c.numOpen)),
+		Idle:          c.Len(),
+		InUse:         int(atomic.LoadInt64(&c.inUse)),
+		Waiters:       int(atomic.LoadInt64(&c.waiters)),
+
+		Generation: gen,
+		StaleOpen:  c.staleOpen(gen),
+		Backends:   c.backendsOpen(),
 	}
 }
 
-func (c *channelPool) Len() int { return len(c.getRconns()) }
+// trackOpen adds delta to the number of open rconns of the
+// generation and the backend of e.
+func (c *channelPool) trackOpen(e *rconnEntry, delta int) {
+	c.trackMu.Lock()
+	defer c.trackMu.Unlock()
+
+	if c.gens == nil {
+		c.gens = map[uint64]int{}
+	}
+	if n := c.gens[e.gen] + delta; n != 0 {
+		c.gens[e.gen] = n
+	} else {
+		delete(c.gens, e.gen)
+	}
+
+	if c.backends != nil {
+		if name, ok := e.meta[BackendMetaKey]; ok {
+			c.backends[name] += delta
+		}
+	}
+}
+
+// backendsOpen returns a copy of the number of open rconns per
+// backend, or nil if the pool is not a weighted one.
+func (c *channelPool) backendsOpen() map[string]int {
+	c.trackMu.Lock()
+	defer c.trackMu.Unlock()
+
+	if c.backends == nil {
+		return nil
+	}
+	backends := make(map[string]int, len(c.backends))
+	for name, n := range c.backends {
+		backends[name] = n
+	}
+	return backends
+}
+
+// staleOpen returns the number of open rconns from generations older
+// than gen.
+func (c *channelPool) staleOpen(gen uint64) int {
+	c.trackMu.Lock()
+	defer c.trackMu.Unlock()
+
+	stale := 0
+	for g, n := range c.gens {
+		if g < gen {
+			stale += n
+		}
+	}
+	return stale
+}
@@ -1,11 +1,17 @@
 package pool
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net"
 	"net/rpc"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -38,6 +44,24 @@ func TestNew(t *testing.T) {
 		t.Errorf("New error: %s", err)
 	}
 }
+
+func TestNew_InvalidCapacity(t *testing.T) {
+	for _, tc := range []struct {
+		initialCap, maxCap int
+		expected           error
+	}{
+		{initialCap: -1, maxCap: 5, expected: ErrInvalidInitialCap},
+		{initialCap: 0, maxCap: 0, expected: ErrInvalidMaxCap},
+		{initialCap: 0, maxCap: -3, expected: ErrInvalidMaxCap},
+		{initialCap: 6, maxCap: 5, expected: ErrInitialExceedsMax},
+	} {
+		_, err := NewChannelPool(tc.initialCap, tc.maxCap, newStubFactory())
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("New(%d, %d) error. Expecting %v, got %v",
+				tc.initialCap, tc.maxCap, tc.expected, err)
+		}
+	}
+}
 func TestPool_Get_Impl(t *testing.T) {
 	p, _ := newChannelPool()
 	defer p.Close()
@@ -189,73 +213,2108 @@ func TestPool_Close(t *testing.T) {
 	}
 }
 
-func TestPoolConcurrent(t *testing.T) {
-	p, _ := newChannelPool()
-	pipe := make(chan RpcAble, 0)
-
-	go func() {
-		p.Close()
-	}()
+func TestPool_CloseWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	for i := 0; i < MaximumCap; i++ {
-		go func() {
-			rconn, _ := p.Get()
+	p, err := NewChannelPoolWithContext(ctx, InitialCap, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IsClosed() {
+		t.Fatal("CloseWithContext error. Pool should not be closed yet")
+	}
 
-			pipe <- rconn
-		}()
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for !p.IsClosed() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !p.IsClosed() {
+		t.Errorf("CloseWithContext error. Pool should be closed")
+	}
+	if _, err := p.Get(); err != ErrClosed {
+		t.Errorf("CloseWithContext error. Expecting %v, got %v", ErrClosed, err)
+	}
 
-		go func() {
-			rconn := <-pipe
-			if rconn == nil {
-				return
-			}
-			rconn.Close()
-		}()
+	// a pool closed manually doesn't wait for its context
+	p, err = NewChannelPoolWithContext(context.Background(), InitialCap, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Close error. Expecting no error, got %v", err)
 	}
 }
 
-//func TestPoolWriteRead(t *testing.T) {
-//	p, _ := NewChannelPool(0, 30, factory)
-//
-//	rconn, _ := p.Get()
-//
-//	conn := rconn.(net.Conn)
-//
-//	msg := "hello"
-//	_, err := conn.Write([]byte(msg))
-//	if err != nil {
-//		t.Error(err)
-//	}
-//}
+func TestPool_CloseOrder(t *testing.T) {
+	var order []int
+	p, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory(),
+		WithCloseFunc(func(rconn RpcAble) error {
+			order = append(order, rconn.(*stubRconn).id)
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
 
-func TestPoolConcurrent2(t *testing.T) {
-	p, _ := NewChannelPool(0, 30, factory)
+	// #1 becomes the most recently returned
+	rconn, _ := p.Get()
+	rconn.Close()
 
-	var wg sync.WaitGroup
+	p.Close()
+	expected := []int{2, 3, 4, 5, 1}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("Close error. Expecting order %v, got %v", expected, order)
+	}
+}
 
-	go func() {
+func TestPool_CloseRacingPut(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		var (
+			mu    sync.Mutex
+			stubs []*stubRconn
+		)
+		stubFactory := newStubFactory()
+		p, err := NewChannelPool(InitialCap, MaximumCap, func() (RpcAble, error) {
+			rconn, err := stubFactory()
+			mu.Lock()
+			stubs = append(stubs, rconn.(*stubRconn))
+			mu.Unlock()
+			return rconn, err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rconns []Conn
 		for i := 0; i < 10; i++ {
+			rconn, _ := p.Get()
+			rconns = append(rconns, rconn)
+		}
+
+		// return the rconns while closing the pool
+		var wg sync.WaitGroup
+		for _, rconn := range rconns {
 			wg.Add(1)
-			go func(i int) {
-				rconn, _ := p.Get()
-				time.Sleep(time.Millisecond * time.Duration(rand.Intn(100)))
+			go func(rconn Conn) {
+				defer wg.Done()
 				rconn.Close()
-				wg.Done()
-			}(i)
+			}(rconn)
 		}
-	}()
+		p.Close()
+		wg.Wait()
 
-	for i := 0; i < 10; i++ {
-		wg.Add(1)
-		go func(i int) {
-			rconn, _ := p.Get()
-			time.Sleep(time.Millisecond * time.Duration(rand.Intn(100)))
-			rconn.Close()
-			wg.Done()
-		}(i)
+		mu.Lock()
+		for _, stub := range stubs {
+			stub.mu.Lock()
+			closed := stub.closed
+			stub.mu.Unlock()
+			if closed != 1 {
+				t.Errorf("Close error. Expecting rconn #%d closed once, got %d", stub.id, closed)
+			}
+		}
+		if n := p.Stats().Closed; n != int64(len(stubs)) {
+			t.Errorf("Close error. Expecting %d closed, got %d", len(stubs), n)
+		}
+		mu.Unlock()
 	}
+}
 
-	wg.Wait()
+func TestPool_CloseTwice(t *testing.T) {
+	p, _ := newChannelPool()
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close error. Expecting no error, got %v", err)
+	}
+	if err := p.Close(); err != ErrAlreadyClosed {
+		t.Errorf("Close error. Expecting %v, got %v", ErrAlreadyClosed, err)
+	}
+	if err := p.CloseContext(context.Background()); err != ErrAlreadyClosed {
+		t.Errorf("CloseContext error. Expecting %v, got %v", ErrAlreadyClosed, err)
+	}
+}
+
+func TestPool_Done(t *testing.T) {
+	p, _ := NewChannelPool(2, 2, newStubFactory())
+	done := p.Done()
+
+	rconn, _ := p.Get()
+	p.Close()
+
+	select {
+	case <-done:
+		t.Fatal("Done error. Expecting the checked-out rconn to be waited for")
+	default:
+	}
+
+	rconn.Close()
+	for i := 0; i < 2; i++ { // several consumers, before and after Close()
+		select {
+		case <-p.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Done error. Expecting the channel to be closed")
+		}
+	}
+	if stats := p.Stats(); stats.Open != 0 {
+		t.Errorf("Done error. Expecting no open rconn, got %d", stats.Open)
+	}
+
+	// an empty pool is drained as soon as closed
+	p, _ = NewChannelPool(0, 2, newStubFactory())
+	p.Close()
+	select {
+	case <-p.Done():
+	default:
+		t.Error("Done error. Expecting the channel to be closed")
+	}
+}
+
+func TestPool_CloseErrors(t *testing.T) {
+	closeErr := errors.New("close failed")
+	p, err := NewChannelPool(3, MaximumCap, newStubFactory(),
+		WithCloseFunc(func(RpcAble) error { return closeErr }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Close()
+	errs, ok := err.(MultiError)
+	if !ok {
+		t.Fatalf("Close error. Expecting a MultiError, got %v", err)
+	}
+	if len(errs) != 3 {
+		t.Errorf("Close error. Expecting %d errors, got %d", 3, len(errs))
+	}
+	for _, err := range errs {
+		if err != closeErr {
+			t.Errorf("Close error. Expecting %v, got %v", closeErr, err)
+		}
+	}
+}
+
+func TestPool_Stats(t *testing.T) {
+	p, _ := NewChannelPool(1, MaximumCap, factory)
+	defer p.Close()
+
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+
+	stats := p.Stats()
+	if stats.Created != 2 || stats.InUse != 2 || stats.Idle != 0 ||
+		stats.WaitCount != 1 || stats.MaxCap != MaximumCap {
+		t.Errorf("Stats error. Unexpected stats: %+v", stats)
+	}
+
+	rconn1.Close()
+	rconn2.(*PoolRconn).MarkUnusable()
+	rconn2.Close()
+
+	stats = p.Stats()
+	if stats.Closed != 1 || stats.InUse != 0 || stats.Idle != 1 {
+		t.Errorf("Stats error. Unexpected stats: %+v", stats)
+	}
+}
+
+func TestPool_FactoryPanic(t *testing.T) {
+	logger := &testLogger{}
+	panicking := true
+	p, err := NewChannelPool(0, MaximumCap, func() (RpcAble, error) {
+		if panicking {
+			panic("boom")
+		}
+		return factory()
+	}, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	_, err = p.Get()
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Get error. Expecting a factory panic error, got %v", err)
+	}
+	if logger.count() != 1 {
+		t.Errorf("Factory panic should have been logged")
+	}
+
+	panicking = false
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	rconn.Close()
+}
+
+func TestPool_FillTolerance(t *testing.T) {
+	failing := func(fails int) Factory {
+		stubs := newStubFactory()
+		n := 0
+		return func() (RpcAble, error) {
+			if n++; n <= fails {
+				return nil, errors.New("backend down")
+			}
+			return stubs()
+		}
+	}
+
+	logger := &testLogger{}
+	p, err := NewChannelPool(InitialCap, MaximumCap, failing(1),
+		WithLogger(logger), WithFillTolerance(1))
+	if err != nil {
+		t.Fatalf("FillTolerance error: %s", err)
+	}
+	defer p.Close()
+	if p.Len() != InitialCap-1 {
+		t.Errorf("FillTolerance error. Expecting %d, got %d", InitialCap-1, p.Len())
+	}
+	if logger.count() != 1 {
+		t.Errorf("FillTolerance error. Expecting %d logs, got %d", 1, logger.count())
+	}
+
+	_, err = NewChannelPool(InitialCap, MaximumCap, failing(2),
+		WithLogger(logger), WithFillTolerance(1))
+	if err == nil {
+		t.Errorf("FillTolerance error. Expecting an error beyond the tolerance")
+	}
+}
+
+func TestPool_FillValidation(t *testing.T) {
+	// rconns #1 and #2 are dead on arrival
+	validator := func(rconn RpcAble) error {
+		if rconn.(*stubRconn).id <= 2 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+
+	logger := &testLogger{}
+	_, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory(),
+		WithLogger(logger), WithValidator(validator), WithFillValidation())
+	if err == nil {
+		t.Errorf("FillValidation error. Expecting an error")
+	}
+
+	p, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory(),
+		WithLogger(logger), WithValidator(validator), WithFillValidation(),
+		WithFillTolerance(2))
+	if err != nil {
+		t.Fatalf("FillValidation error: %s", err)
+	}
+	defer p.Close()
+	if p.Len() != InitialCap-2 {
+		t.Errorf("FillValidation error. Expecting %d, got %d", InitialCap-2, p.Len())
+	}
+	if stats := p.Stats(); stats.Closed != 2 || stats.Open != InitialCap-2 {
+		t.Errorf("FillValidation error. Unexpected stats: %+v", stats)
+	}
+
+	// without WithFillValidation(), rconns are only validated by Get()
+	p2, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory(),
+		WithValidator(validator))
+	if err != nil {
+		t.Fatalf("FillValidation error: %s", err)
+	}
+	defer p2.Close()
+	if p2.Len() != InitialCap {
+		t.Errorf("FillValidation error. Expecting %d, got %d", InitialCap, p2.Len())
+	}
+}
+
+func TestPool_OnClosePanic(t *testing.T) {
+	logger := &testLogger{}
+	p, err := NewChannelPool(InitialCap, MaximumCap, factory,
+		WithLogger(logger),
+		WithOnClose(func(RpcAble) { panic("boom") }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Close()
+
+	if logger.count() != InitialCap {
+		t.Errorf("OnClose panics error. Expecting %d logs, got %d",
+			InitialCap, logger.count())
+	}
+	if stats := p.Stats(); stats.Closed != int64(InitialCap) {
+		t.Errorf("OnClose panics error. Expecting %d closed, got %d",
+			InitialCap, stats.Closed)
+	}
+}
+
+func TestPool_FactoryWithCleanup(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		cleanups = map[int]int{}
+	)
+	factory := newStubFactory()
+	p, err := NewChannelPoolWithCleanup(2, 2, func() (RpcAble, func(), error) {
+		rconn, err := factory()
+		stub := rconn.(*stubRconn)
+		return rconn, func() {
+			if !stub.isClosed() {
+				t.Errorf("Cleanup error. Expecting #%d to be closed first", stub.id)
+			}
+			mu.Lock()
+			cleanups[stub.id]++
+			mu.Unlock()
+		}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// returned rconns are not cleaned up
+	rconn, _ := p.Get()
+	rconn.Close()
+	rconn, _ = p.Get()
+	id := rconn.(*PoolRconn).RpcAble.(*stubRconn).id
+	if len(cleanups) != 0 {
+		t.Errorf("Cleanup error. Expecting no cleanup, got %v", cleanups)
+	}
+
+	// retired rconn
+	rconn.MarkUnusable()
+	rconn.Close()
+	if cleanups[id] != 1 || len(cleanups) != 1 {
+		t.Errorf("Cleanup error. Expecting #%d cleaned up once, got %v", id, cleanups)
+	}
+
+	// pool shutdown
+	p.Close()
+	if cleanups[1] != 1 || cleanups[2] != 1 || len(cleanups) != 2 {
+		t.Errorf("Cleanup error. Expecting each rconn cleaned up once, got %v", cleanups)
+	}
+}
+
+func TestPool_CloseFunc(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		closed []RpcAble
+	)
+	p, err := NewChannelPool(2, 2, newStubFactory(),
+		WithFullPolicy(FullPolicyEvictOldest),
+		WithCloseFunc(func(rconn RpcAble) error {
+			mu.Lock()
+			closed = append(closed, rconn)
+			mu.Unlock()
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldest, _ := p.Get()
+	stub := oldest.(*PoolRconn).RpcAble
+	oldest.Close()
+	p.Put(&stubRconn{})
+
+	// the eviction of the oldest idle rconn uses the close func
+	mu.Lock()
+	if len(closed) != 1 || closed[0].(*stubRconn).id != 2 {
+		t.Errorf("CloseFunc error. Expecting rconn #2 to be closed, got %v", closed)
+	}
+	mu.Unlock()
+	if stub.(*stubRconn).isClosed() {
+		t.Errorf("CloseFunc error. Close() should not be called")
+	}
+
+	p.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(closed) != 3 {
+		t.Errorf("CloseFunc error. Expecting %d calls, got %d", 3, len(closed))
+	}
+	for _, rconn := range closed {
+		if rconn.(*stubRconn).isClosed() {
+			t.Errorf("CloseFunc error. Close() should not be called")
+		}
+	}
+}
+
+func TestPool_CloseSequential(t *testing.T) {
+	var active, maxActive int32
+	p, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory(),
+		WithOnClose(func(RpcAble) {
+			n := atomic.AddInt32(&active, 1)
+			if n > atomic.LoadInt32(&maxActive) {
+				atomic.StoreInt32(&maxActive, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unlike CloseContext(), Close() closes idle rconns one at a time
+	p.Close()
+	if n := atomic.LoadInt32(&maxActive); n != 1 {
+		t.Errorf("Close error. Expecting %d concurrent OnClose hook, got %d", 1, n)
+	}
+	if closed := p.Stats().Closed; closed != int64(InitialCap) {
+		t.Errorf("Close error. Expecting %d closed, got %d", InitialCap, closed)
+	}
+}
+
+func TestPool_CloseFuncUnlocked(t *testing.T) {
+	logger := &testLogger{}
+	var p Pool
+	p, err := NewChannelPool(1, 1, newStubFactory(),
+		WithLogger(logger),
+		WithCloseFunc(func(rconn RpcAble) error {
+			// would deadlock if called with the pool locked
+			p.Inspect()
+			panic("boom")
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Put(&stubRconn{}) }()
+	select {
+	case err := <-done:
+		if err != ErrFull {
+			t.Errorf("Put error. Expecting %v, got %v", ErrFull, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("CloseFunc error. Put() deadlocked")
+	}
+
+	p.Close()
+	if logger.count() != 2 {
+		t.Errorf("CloseFunc error. Expecting %d logged panics, got %d", 2, logger.count())
+	}
+	if closed := p.Stats().Closed; closed != 2 {
+		t.Errorf("CloseFunc error. Expecting %d closed, got %d", 2, closed)
+	}
+}
+
+func TestPool_FullPolicyEvictOldest(t *testing.T) {
+	p, err := NewChannelPool(0, 3, newStubFactory(),
+		WithFullPolicy(FullPolicyEvictOldest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconns := make([]RpcAble, 4)
+	for i := range rconns {
+		rconns[i], _ = p.Get()
+	}
+	oldest := rconns[0].(*PoolRconn).RpcAble.(*stubRconn)
+
+	// fill the pool, then return an extra rconn
+	for _, rconn := range rconns {
+		rconn.Close()
+	}
+
+	if p.Len() != 3 {
+		t.Errorf("EvictOldest error. Expecting %d, got %d", 3, p.Len())
+	}
+
+	if !oldest.isClosed() {
+		t.Errorf("EvictOldest error. Oldest rconn should be closed")
+	}
+
+	for i := 1; i < len(rconns); i++ {
+		rconn, _ := p.Get()
+		stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+		if stub.isClosed() || stub.id != i+1 {
+			t.Errorf("EvictOldest error. Expecting open rconn #%d, got #%d (closed=%t)",
+				i+1, stub.id, stub.isClosed())
+		}
+	}
+}
+
+func TestPool_ResetGeneration(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var rconns []Conn
+	for i := 0; i < 3; i++ {
+		rconn, _ := p.Get()
+		rconns = append(rconns, rconn)
+	}
+
+	if err := p.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	stats := p.Stats()
+	if stats.Generation != 1 {
+		t.Errorf("Stats error. Expecting generation %d, got %d", 1, stats.Generation)
+	}
+	if stats.StaleOpen != 3 {
+		t.Errorf("Stats error. Expecting %d stale, got %d", 3, stats.StaleOpen)
+	}
+
+	// returned stale rconns are closed, while new ones are pooled
+	for _, rconn := range rconns {
+		fresh, _ := p.Get()
+		rconn.Close()
+		fresh.Close()
+	}
+	stats = p.Stats()
+	if stats.StaleOpen != 0 {
+		t.Errorf("Stats error. Expecting no stale, got %d", stats.StaleOpen)
+	}
+	if stats.Open != 2 {
+		t.Errorf("Stats error. Expecting %d open, got %d", 2, stats.Open)
+	}
+}
+
+func TestPool_Reset(t *testing.T) {
+	p, err := NewChannelPool(3, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	checkedOut, _ := p.Get()
+	checkedOutStub := checkedOut.(*PoolRconn).RpcAble.(*stubRconn)
+	extra, _ := p.Get()
+	extra.Close()
+
+	if err := p.Reset(); err != nil {
+		t.Fatalf("Reset error: %s", err)
+	}
+
+	if p.Len() != 3 {
+		t.Errorf("Reset error. Expecting %d, got %d", 3, p.Len())
+	}
+
+	// the checked-out rconn is outdated, so closed instead of returned
+	checkedOut.Close()
+	if !checkedOutStub.isClosed() {
+		t.Errorf("Reset error. Checked-out rconn should be closed on return")
+	}
+	if p.Len() != 3 {
+		t.Errorf("Reset error. Expecting %d, got %d", 3, p.Len())
+	}
+
+	// only fresh rconns remain
+	for i := 0; i < 3; i++ {
+		rconn, _ := p.Get()
+		if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id <= 3 {
+			t.Errorf("Reset error. Got old rconn #%d", stub.id)
+		}
+	}
+
+	p.Close()
+	if err := p.Reset(); err != ErrClosed {
+		t.Errorf("Reset error. Expecting ErrClosed, got %v", err)
+	}
+}
+
+func TestPool_SwapConnections(t *testing.T) {
+	p, _ := NewChannelPool(2, 3, newStubFactory())
+	defer p.Close()
+
+	checkedOut, _ := p.Get()
+	oldStub := checkedOut.(*PoolRconn).RpcAble.(*stubRconn)
+	idle, _ := p.Get()
+	idleStub := idle.(*PoolRconn).RpcAble.(*stubRconn)
+	idle.Close()
+
+	newStubs := map[RpcAble]bool{}
+	var rconns []RpcAble
+	for i := 0; i < 2; i++ {
+		stub := &stubRconn{id: 100 + i}
+		newStubs[stub] = true
+		rconns = append(rconns, stub)
+	}
+	if err := p.SwapConnections(rconns); err != nil {
+		t.Fatalf("SwapConnections error: %s", err)
+	}
+	if !idleStub.isClosed() {
+		t.Errorf("SwapConnections error. Old idle rconn should be closed")
+	}
+
+	// the old checked-out rconn is closed on return
+	checkedOut.Close()
+	if !oldStub.isClosed() {
+		t.Errorf("SwapConnections error. Old checked-out rconn should be closed on return")
+	}
+
+	// only the new rconns are handed out
+	for i := 0; i < 2; i++ {
+		rconn, _ := p.Get()
+		defer rconn.Close()
+		if !newStubs[rconn.(*PoolRconn).RpcAble] {
+			t.Errorf("SwapConnections error. Got an unexpected rconn")
+		}
+	}
+	if stats := p.Stats(); stats.Open != 2 || stats.StaleOpen != 0 {
+		t.Errorf("SwapConnections error. Expecting %d open and no stale, got %+v", 2, stats)
+	}
+
+	if err := p.SwapConnections(make([]RpcAble, 1)); err == nil {
+		t.Errorf("SwapConnections error. Expecting an error for nil rconns")
+	}
+	tooMany := []RpcAble{&stubRconn{}, &stubRconn{}, &stubRconn{}, &stubRconn{}}
+	if err := p.SwapConnections(tooMany); err != ErrFull {
+		t.Errorf("SwapConnections error. Expecting %v, got %v", ErrFull, err)
+	}
+
+	p.Close()
+	if err := p.SwapConnections(nil); err != ErrClosed {
+		t.Errorf("SwapConnections error. Expecting %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestPool_MinIdle(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory(), WithMinIdle(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	waitLen := func(expected int) {
+		deadline := time.Now().Add(time.Second)
+		for p.Len() != expected && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if p.Len() != expected {
+			t.Errorf("MinIdle error. Expecting %d, got %d", expected, p.Len())
+		}
+	}
+
+	waitLen(3)
+
+	// drain the pool
+	for i := 0; i < 3; i++ {
+		p.Get()
+	}
+
+	waitLen(3)
+}
+
+func TestPool_PutAdopt(t *testing.T) {
+	p, err := NewChannelPool(0, 1, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Put(nil); err == nil {
+		t.Errorf("Put error. A nil rconn should be rejected")
+	}
+
+	adopted := &stubRconn{id: 42}
+	if err := p.Put(adopted); err != nil {
+		t.Fatalf("Put error: %s", err)
+	}
+	if p.Len() != 1 {
+		t.Errorf("Put error. Expecting %d, got %d", 1, p.Len())
+	}
+
+	// pool is full
+	extra := &stubRconn{id: 43}
+	if err := p.Put(extra); err != ErrFull {
+		t.Errorf("Put error. Expecting ErrFull, got %v", err)
+	}
+	if !extra.isClosed() {
+		t.Errorf("Put error. Rconn put into a full pool should be closed")
+	}
+
+	rconn, _ := p.Get()
+	if rconn.(*PoolRconn).RpcAble != adopted {
+		t.Errorf("Put error. Get should return the adopted rconn")
+	}
+
+	// once returned, the adopted rconn stays in the pool
+	rconn.Close()
+	if p.Len() != 1 || adopted.isClosed() {
+		t.Errorf("Put error. Adopted rconn should be back in the pool")
+	}
+}
+
+func TestPool_PutWrongPool(t *testing.T) {
+	pa, _ := NewChannelPool(1, MaximumCap, newStubFactory())
+	defer pa.Close()
+	pb, _ := NewChannelPool(1, MaximumCap, newStubFactory())
+	defer pb.Close()
+
+	rconn, _ := pa.Get()
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+
+	// a Conn of pa is rejected by pb
+	if err := pb.Put(rconn); err != errWrongPool {
+		t.Errorf("Put error. Expecting %v, got %v", errWrongPool, err)
+	}
+	if stub.isClosed() || pb.Len() != 1 {
+		t.Errorf("Put error. Rejected rconn should be left untouched")
+	}
+	if stats := pb.Stats(); stats.Created != 1 || stats.Closed != 0 {
+		t.Errorf("Put error. Unexpected stats for other pool %+v", stats)
+	}
+
+	// and simply returned by pa
+	if err := pa.Put(rconn); err != nil {
+		t.Errorf("Put error: %s", err)
+	}
+	if stats := pa.Stats(); stats.InUse != 0 || stats.Idle != 1 || stats.Created != 1 {
+		t.Errorf("Put error. Unexpected stats for owning pool %+v", stats)
+	}
+	if stub.isClosed() {
+		t.Errorf("Put error. Returned rconn should not be closed")
+	}
+}
+
+func TestPool_String(t *testing.T) {
+	p, _ := newChannelPool()
+
+	rconn, _ := p.Get()
+	defer rconn.Close()
+
+	expected := fmt.Sprintf("ChannelPool{idle=%d, inUse=1, max=%d, closed=false}",
+		InitialCap-1, MaximumCap)
+	if got := fmt.Sprint(p); got != expected {
+		t.Errorf("String error. Expecting %q, got %q", expected, got)
+	}
+
+	p.Close()
+
+	expected = fmt.Sprintf("ChannelPool{idle=0, inUse=1, max=%d, closed=true}",
+		MaximumCap)
+	if got := fmt.Sprint(p); got != expected {
+		t.Errorf("String error. Expecting %q, got %q", expected, got)
+	}
+}
+
+func TestPool_LenTracksChannel(t *testing.T) {
+	p, err := NewChannelPool(2, 3, newStubFactory(),
+		WithFullPolicy(FullPolicyEvictOldest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := p.(*channelPool)
+
+	check := func(step string) {
+		if p.Len() != len(c.rconns) {
+			t.Errorf("Len error after %s. Expecting %d, got %d",
+				step, len(c.rconns), p.Len())
+		}
+	}
+
+	check("fill")
+
+	rconns := make([]RpcAble, 4)
+	for i := range rconns {
+		rconns[i], _ = p.Get()
+	}
+	check("Get")
+
+	for _, rconn := range rconns {
+		rconn.Close()
+	}
+	check("put")
+
+	p.Put(&stubRconn{})
+	check("Put")
+
+	p.Reset()
+	check("Reset")
+
+	p.Close()
+	if p.Len() != 0 {
+		t.Errorf("Len error after Close. Expecting 0, got %d", p.Len())
+	}
+}
+
+func BenchmarkPool_Len(b *testing.B) {
+	p, _ := NewChannelPool(InitialCap, MaximumCap, newStubFactory())
+	defer p.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				rconn, _ := p.Get()
+				rconn.Close()
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Len()
+		}
+	})
+}
+
+func TestPool_HealthSweep(t *testing.T) {
+	var failing int32
+	p, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory(),
+		WithHealthSweep(10*time.Millisecond, func(RpcAble) error {
+			if atomic.LoadInt32(&failing) != 0 {
+				return errors.New("dead")
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	time.Sleep(30 * time.Millisecond)
+	if stats := p.Stats(); stats.Closed != 0 {
+		t.Errorf("HealthSweep error. Healthy rconns should be kept, %d closed",
+			stats.Closed)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if p.Len() != 0 {
+		t.Errorf("HealthSweep error. Expecting %d, got %d", 0, p.Len())
+	}
+	if stats := p.Stats(); stats.Closed != int64(InitialCap) {
+		t.Errorf("HealthSweep error. Expecting %d closed, got %d",
+			InitialCap, stats.Closed)
+	}
+}
+
+func TestPool_Flush(t *testing.T) {
+	p, _ := NewChannelPool(3, 5, newStubFactory())
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	defer rconn.Close()
+	var old []*stubRconn
+	for _, e := range idleEntries(p) {
+		old = append(old, e.rconn.(*stubRconn))
+	}
+
+	if n := p.Flush(func(RpcAble) error { return errors.New("stale") }); n != 2 {
+		t.Errorf("Flush error. Expecting %d replaced, got %d", 2, n)
+	}
+	for _, stub := range old {
+		if !stub.isClosed() {
+			t.Errorf("Flush error. Expecting rconn #%d to be closed", stub.id)
+		}
+	}
+	if p.Len() != 2 {
+		t.Errorf("Flush error. Expecting %d idle, got %d", 2, p.Len())
+	}
+	for _, e := range idleEntries(p) {
+		if id := e.rconn.(*stubRconn).id; id <= 3 {
+			t.Errorf("Flush error. Got old rconn #%d", id)
+		}
+	}
+
+	// healthy rconns are kept
+	if n := p.Flush(func(RpcAble) error { return nil }); n != 0 {
+		t.Errorf("Flush error. Expecting %d replaced, got %d", 0, n)
+	}
+	if stats := p.Stats(); stats.Idle != 2 || stats.Closed != 2 {
+		t.Errorf("Flush error. Expecting %d idle and %d closed, got %+v", 2, 2, stats)
+	}
+
+	p.Close()
+	if n := p.Flush(func(RpcAble) error { return nil }); n != 0 {
+		t.Errorf("Flush error. Expecting %d replaced once closed, got %d", 0, n)
+	}
+}
+
+// idleEntries returns the idle entries of p, leaving them in place.
+func idleEntries(p Pool) []*rconnEntry {
+	c := p.(*channelPool)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entries []*rconnEntry
+	c.rotate(func(e *rconnEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	return entries
+}
+
+func TestPool_IntervalJitter(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory(),
+		WithIntervalJitter(0.2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	c := p.(*channelPool)
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		d := c.jitter(time.Second)
+		if d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("IntervalJitter error. Interval %s out of bounds", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("IntervalJitter error. Intervals should vary")
+	}
+
+	// capped fraction
+	p2, _ := NewChannelPool(0, MaximumCap, newStubFactory(),
+		WithIntervalJitter(3))
+	defer p2.Close()
+	for i := 0; i < 100; i++ {
+		if d := p2.(*channelPool).jitter(time.Second); d < 500*time.Millisecond {
+			t.Fatalf("IntervalJitter error. Interval %s out of bounds", d)
+		}
+	}
+}
+
+func TestPool_GetValidated(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var rejected *stubRconn
+	rconn, err := p.GetValidated(func(rconn RpcAble) bool {
+		if stub := rconn.(*stubRconn); stub.id == 1 {
+			rejected = stub
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("GetValidated error: %s", err)
+	}
+
+	if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id != 2 {
+		t.Errorf("GetValidated error. Expecting rconn #2, got #%d", stub.id)
+	}
+	if rejected == nil || !rejected.isClosed() {
+		t.Errorf("GetValidated error. Rejected rconn should be closed")
+	}
+}
+
+func TestPool_WithConn(t *testing.T) {
+	errApp := errors.New("application error")
+	p, err := NewChannelPool(1, MaximumCap, newStubFactory(),
+		WithRetireOn(func(err error) bool { return err != errApp }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var stub *stubRconn
+	run := func(fnErr error) error {
+		return p.WithConn(func(rconn RpcAble) error {
+			stub = rconn.(*PoolRconn).RpcAble.(*stubRconn)
+			return fnErr
+		})
+	}
+
+	// success, rconn returned
+	if err := run(nil); err != nil {
+		t.Errorf("WithConn error. Expecting no error, got %v", err)
+	}
+	if stub.isClosed() || p.Len() != 1 {
+		t.Errorf("WithConn error. Expecting rconn to be returned")
+	}
+
+	// non-retiring error, rconn returned
+	if err := run(errApp); err != errApp {
+		t.Errorf("WithConn error. Expecting %v, got %v", errApp, err)
+	}
+	if stub.isClosed() || p.Len() != 1 {
+		t.Errorf("WithConn error. Expecting rconn to be returned")
+	}
+
+	// retiring error, rconn closed
+	errNet := errors.New("connection reset")
+	if err := run(errNet); err != errNet {
+		t.Errorf("WithConn error. Expecting %v, got %v", errNet, err)
+	}
+	if !stub.isClosed() || p.Len() != 0 {
+		t.Errorf("WithConn error. Expecting rconn to be retired")
+	}
+
+	p.Close()
+	if err := run(nil); err != ErrClosed {
+		t.Errorf("WithConn error. Expecting %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestPool_WithConnRetry(t *testing.T) {
+	p, err := NewChannelPool(1, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// first rconn is shut down
+	rconn, _ := p.Get()
+	first := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	first.callErr = rpc.ErrShutdown
+	rconn.Close()
+
+	var ids []int
+	err = p.WithConnRetry(3, nil, func(rconn RpcAble) error {
+		ids = append(ids, rconn.(*PoolRconn).RpcAble.(*stubRconn).id)
+		return rconn.Call("Svc.Method", nil, nil)
+	})
+	if err != nil {
+		t.Errorf("WithConnRetry error. Expecting no error, got %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("WithConnRetry error. Expecting rconns #1 then #2, got %v", ids)
+	}
+	if !first.isClosed() {
+		t.Errorf("WithConnRetry error. Expecting shut down rconn to be closed")
+	}
+
+	// non-retriable errors return immediately
+	errApp := errors.New("application error")
+	calls := 0
+	err = p.WithConnRetry(3, nil, func(RpcAble) error {
+		calls++
+		return errApp
+	})
+	if err != errApp || calls != 1 {
+		t.Errorf("WithConnRetry error. Expecting %v after 1 call, got %v after %d", errApp, err, calls)
+	}
+
+	// attempts are bounded
+	calls = 0
+	err = p.WithConnRetry(3, nil, func(RpcAble) error {
+		calls++
+		return io.EOF
+	})
+	if err != io.EOF || calls != 3 {
+		t.Errorf("WithConnRetry error. Expecting %v after 3 calls, got %v after %d", io.EOF, err, calls)
+	}
+}
+
+// replyRconn is a stubRconn setting the reply of its calls.
+type replyRconn struct {
+	stubRconn
+	reply string
+}
+
+func (r *replyRconn) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	*reply.(*string) = r.reply
+	return r.stubRconn.Call(serviceMethod, args, reply)
+}
+
+func TestPool_CallChecked(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, func() (RpcAble, error) {
+		return &replyRconn{reply: "ok"}, nil
+	}, WithRetireOn(func(error) bool { return false }))
+	defer p.Close()
+
+	notFailed := func(reply interface{}) bool {
+		return *reply.(*string) != "failed"
+	}
+
+	var reply string
+	if err := p.CallChecked("Svc.Method", nil, &reply, notFailed); err != nil {
+		t.Errorf("CallChecked error: %s", err)
+	}
+	if reply != "ok" {
+		t.Errorf("CallChecked error. Expecting reply %q, got %q", "ok", reply)
+	}
+	if stats := p.Stats(); stats.Idle != 1 || stats.Closed != 0 {
+		t.Errorf("CallChecked error. Expecting rconn back to the pool, got %+v", stats)
+	}
+
+	// an error-flagged reply retires the rconn, whatever WithRetireOn()
+	rconn, _ := p.Get()
+	bad := rconn.(*PoolRconn).RpcAble.(*replyRconn)
+	bad.reply = "failed"
+	rconn.Close()
+	if err := p.CallChecked("Svc.Method", nil, &reply, notFailed); err != ErrBadReply {
+		t.Errorf("CallChecked error. Expecting %v, got %v", ErrBadReply, err)
+	}
+	if !bad.isClosed() {
+		t.Errorf("CallChecked error. Expecting the rconn to be retired")
+	}
+
+	// no check
+	if err := p.CallChecked("Svc.Method", nil, &reply, nil); err != nil {
+		t.Errorf("CallChecked error: %s", err)
+	}
+}
+
+func TestPool_GoAndRelease(t *testing.T) {
+	unblock := make(chan struct{})
+	p, err := NewChannelPool(1, MaximumCap, func() (RpcAble, error) {
+		return &slowGoRconn{unblock: unblock}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	errc := p.GoAndRelease("Svc.Method", nil, nil)
+
+	// the rconn stays checked out while the call is in progress
+	time.Sleep(10 * time.Millisecond)
+	if stats := p.Stats(); stats.InUse != 1 || stats.Idle != 0 {
+		t.Errorf("GoAndRelease error. Expecting rconn to be checked out, got %+v", stats)
+	}
+
+	close(unblock)
+	select {
+	case err := <-errc:
+		if err != errSlowGo {
+			t.Errorf("GoAndRelease error. Expecting %v, got %v", errSlowGo, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GoAndRelease error. Call still in progress")
+	}
+	if stats := p.Stats(); stats.InUse != 0 || stats.Idle != 1 {
+		t.Errorf("GoAndRelease error. Expecting rconn to be returned, got %+v", stats)
+	}
+
+	p.Close()
+	if err := <-p.GoAndRelease("Svc.Method", nil, nil); err != ErrClosed {
+		t.Errorf("GoAndRelease error. Expecting %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestPool_PanicSafety(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	// mustPanic calls fn, expected to panic once an rconn is checked
+	// out, and checks the rconn was retired before the panic surfaced
+	mustPanic := func(name string, fn func(checkedOut func(RpcAble))) {
+		t.Helper()
+		var stub *stubRconn
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("%s error. Expecting the panic to go on, got %v", name, r)
+			}
+			if stub == nil || !stub.isClosed() {
+				t.Errorf("%s error. Expecting the rconn to be retired", name)
+			}
+			if stats := p.Stats(); stats.InUse != 0 {
+				t.Errorf("%s error. Expecting no rconn in use, got %d", name, stats.InUse)
+			}
+		}()
+		fn(func(rconn RpcAble) {
+			stub = rconn.(*PoolRconn).RpcAble.(*stubRconn)
+		})
+	}
+
+	mustPanic("WithConn", func(checkedOut func(RpcAble)) {
+		p.WithConn(func(rconn RpcAble) error {
+			checkedOut(rconn)
+			panic("boom")
+		})
+	})
+
+	mustPanic("Borrow", func(checkedOut func(RpcAble)) {
+		rconn, release, err := p.Borrow()
+		if err != nil {
+			t.Fatalf("Borrow error: %s", err)
+		}
+		defer release()
+		checkedOut(rconn)
+		panic("boom")
+	})
+
+	// the pool is still usable
+	if err := p.WithConn(func(RpcAble) error { return nil }); err != nil {
+		t.Errorf("WithConn error: %s", err)
+	}
+	if p.Len() != 1 {
+		t.Errorf("WithConn error. Expecting %d idle, got %d", 1, p.Len())
+	}
+}
+
+func TestPool_Borrow(t *testing.T) {
+	p, err := NewChannelPool(1, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, release, err := p.Borrow()
+	if err != nil {
+		t.Fatalf("Borrow error: %s", err)
+	}
+	stub := rconn.(*PoolRconn).RpcAble
+
+	release()
+	if p.Len() != 1 {
+		t.Errorf("Borrow error. Expecting %d, got %d", 1, p.Len())
+	}
+
+	// the rconn is now checked out by another borrower, a second
+	// release must not return it
+	other, otherRelease, _ := p.Borrow()
+	if other.(*PoolRconn).RpcAble != stub {
+		t.Fatalf("Borrow error. Expecting the released rconn")
+	}
+	release()
+	if p.Len() != 0 {
+		t.Errorf("Borrow error. Double release returned another rconn, %d idle", p.Len())
+	}
+
+	// unusable rconns are closed
+	other.(Conn).MarkUnusable()
+	otherRelease()
+	otherRelease()
+	if p.Len() != 0 || !stub.(*stubRconn).isClosed() {
+		t.Errorf("Borrow error. Unusable rconn should be closed")
+	}
+	if closed := p.Stats().Closed; closed != 1 {
+		t.Errorf("Borrow error. Expecting %d closed, got %d", 1, closed)
+	}
+}
+
+func TestPool_WaitUntilReady(t *testing.T) {
+	stubs := newStubFactory()
+	p, err := NewChannelPool(0, MaximumCap, func() (RpcAble, error) {
+		time.Sleep(5 * time.Millisecond)
+		return stubs()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// already satisfied
+	if err := p.WaitUntilReady(context.Background(), 0); err != nil {
+		t.Errorf("WaitUntilReady error. Expecting no error, got %v", err)
+	}
+
+	// background warmup
+	go p.Grow(3)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.WaitUntilReady(ctx, 3); err != nil {
+		t.Errorf("WaitUntilReady error. Expecting no error, got %v", err)
+	}
+	if p.Len() < 3 {
+		t.Errorf("WaitUntilReady error. Expecting at least %d idle, got %d", 3, p.Len())
+	}
+
+	// never reached
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.WaitUntilReady(ctx, 10); err != context.DeadlineExceeded {
+		t.Errorf("WaitUntilReady error. Expecting %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestPool_NoSyncDial(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory(), WithNoSyncDial(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn1, _ := p.Get()
+	rconn2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+
+	// drained, no dial
+	if _, err := p.Get(); err != ErrNoIdle {
+		t.Errorf("Get error. Expecting %v, got %v", ErrNoIdle, err)
+	}
+	if n := p.Stats().Created; n != 2 {
+		t.Errorf("NoSyncDial error. Expecting %d created, got %d", 2, n)
+	}
+
+	rconn1.Close()
+	rconn2.Close()
+	if _, err := p.Get(); err != nil {
+		t.Errorf("Get error: %s", err)
+	}
+}
+
+func TestPool_BadPuts(t *testing.T) {
+	var hooked int64
+	p, err := NewChannelPool(1, MaximumCap, newStubFactory(),
+		WithOnBadPut(func() { atomic.AddInt64(&hooked, 1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Put(nil); err == nil {
+		t.Errorf("Put error. Expecting an error for a nil rconn")
+	}
+
+	// from another pool
+	p2, _ := NewChannelPool(1, MaximumCap, newStubFactory())
+	defer p2.Close()
+	foreign, _ := p2.Get()
+	if err := p.Put(foreign); err != errWrongPool {
+		t.Errorf("Put error. Expecting %v, got %v", errWrongPool, err)
+	}
+	foreign.Close()
+
+	// already returned
+	rconn, _ := p.Get()
+	rconn.Close()
+	p.Put(rconn)
+
+	if n := p.Stats().BadPuts; n != 3 {
+		t.Errorf("BadPuts error. Expecting %d, got %d", 3, n)
+	}
+	if n := atomic.LoadInt64(&hooked); n != 3 {
+		t.Errorf("OnBadPut error. Expecting %d calls, got %d", 3, n)
+	}
+	if n := p2.Stats().BadPuts; n != 0 {
+		t.Errorf("BadPuts error. Expecting %d, got %d", 0, n)
+	}
+}
+
+func TestPool_ValidateOnPut(t *testing.T) {
+	var rejected RpcAble
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory(),
+		WithValidateOnPut(func(rconn RpcAble) error {
+			if rconn == rejected {
+				return errors.New("suspect")
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+	rejected = rconn1.(*PoolRconn).RpcAble
+	stub1 := rejected.(*stubRconn)
+	stub2 := rconn2.(*PoolRconn).RpcAble.(*stubRconn)
+
+	rconn1.Close()
+	rconn2.Close()
+	if !stub1.isClosed() {
+		t.Errorf("ValidateOnPut error. Expecting rejected rconn to be closed")
+	}
+	if stub2.isClosed() {
+		t.Errorf("ValidateOnPut error. Expecting accepted rconn to be pooled")
+	}
+	if p.Len() != 1 {
+		t.Errorf("ValidateOnPut error. Expecting %d idle, got %d", 1, p.Len())
+	}
+}
+
+func TestPool_PingIfIdleLongerThan(t *testing.T) {
+	fc := newFakeClock()
+	var pinged []int
+	var pingErr error
+	p, _ := NewChannelPool(2, 2, newStubFactory(), withClock(fc),
+		WithPingIfIdleLongerThan(time.Minute, func(rconn RpcAble) error {
+			pinged = append(pinged, rconn.(*stubRconn).id)
+			return pingErr
+		}))
+	defer p.Close()
+
+	// recently used rconns are not pinged
+	rconn, _ := p.Get()
+	rconn.Close()
+	if len(pinged) != 0 {
+		t.Errorf("PingIfIdleLongerThan error. Expecting no ping, got %v", pinged)
+	}
+
+	// rconns idle past the threshold are
+	fc.Advance(time.Minute)
+	rconn, _ = p.Get()
+	id := rconn.(*PoolRconn).RpcAble.(*stubRconn).id
+	rconn.Close()
+	if len(pinged) != 1 || pinged[0] != id {
+		t.Errorf("PingIfIdleLongerThan error. Expecting rconn #%d pinged, got %v", id, pinged)
+	}
+
+	// and discarded if the ping fails, a fresh one being handed out
+	fc.Advance(time.Minute)
+	pinged, pingErr = nil, errors.New("dead")
+	rconn, _ = p.Get()
+	defer rconn.Close()
+	if len(pinged) != 2 {
+		t.Errorf("PingIfIdleLongerThan error. Expecting %d pings, got %v", 2, pinged)
+	}
+	if id := rconn.(*PoolRconn).RpcAble.(*stubRconn).id; id != 3 {
+		t.Errorf("PingIfIdleLongerThan error. Expecting fresh rconn #%d, got #%d", 3, id)
+	}
+	if closed := p.Stats().Closed; closed != 2 {
+		t.Errorf("PingIfIdleLongerThan error. Expecting %d closed, got %d", 2, closed)
+	}
+}
+
+func TestPool_ValidatorAllUnhealthy(t *testing.T) {
+	p, err := NewChannelPool(3, MaximumCap, newStubFactory(),
+		WithValidator(func(rconn RpcAble) error {
+			if rconn.(*stubRconn).id <= 3 {
+				return errors.New("dead")
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetMaxOpenConns(1)
+
+	// all idle rconns are closed, freeing the slot needed to dial
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id != 4 {
+		t.Errorf("Validator error. Expecting rconn #4, got #%d", stub.id)
+	}
+	rconn.Close()
+
+	// unhealthy rconns keep being returned
+	var p2 Pool
+	p2, err = NewChannelPool(1, 2, newStubFactory(),
+		WithValidator(func(RpcAble) error {
+			p2.Put(&stubRconn{})
+			return errors.New("dead")
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+
+	if _, err := p2.Get(); err != ErrNoHealthyConn {
+		t.Errorf("Get error. Expecting %v, got %v", ErrNoHealthyConn, err)
+	}
+}
+
+func TestPool_Validator(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory(),
+		WithValidator(func(RpcAble) error { return errors.New("dead") }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// all idle rconns are rejected, so a new one is created
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id != 3 {
+		t.Errorf("Validator error. Expecting rconn #3, got #%d", stub.id)
+	}
+	if stats := p.Stats(); stats.Closed != 2 || stats.Idle != 0 {
+		t.Errorf("Validator error. Unexpected stats: %+v", stats)
+	}
+}
+
+func TestPool_SetValidator(t *testing.T) {
+	p, _ := NewChannelPool(2, MaximumCap, newStubFactory())
+	defer p.Close()
+
+	// reject all idle rconns, so a new one is created
+	p.SetValidator(func(RpcAble) error { return errors.New("old version") })
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id != 3 {
+		t.Errorf("SetValidator error. Expecting rconn #3, got #%d", stub.id)
+	}
+	rconn.Close()
+	if stats := p.Stats(); stats.Closed != 2 || stats.Idle != 1 {
+		t.Errorf("SetValidator error. Unexpected stats: %+v", stats)
+	}
+
+	// validation disabled, the idle rconn is handed out again
+	p.SetValidator(nil)
+	rconn, _ = p.Get()
+	defer rconn.Close()
+	if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id != 3 {
+		t.Errorf("SetValidator error. Expecting rconn #3, got #%d", stub.id)
+	}
+	if closed := p.Stats().Closed; closed != 2 {
+		t.Errorf("SetValidator error. Expecting %d closed, got %d", 2, closed)
+	}
+}
+
+func TestPool_IsClosed(t *testing.T) {
+	p, _ := NewChannelPool(1, MaximumCap, newStubFactory())
+
+	if p.IsClosed() {
+		t.Errorf("IsClosed error. Expecting false before Close()")
+	}
+
+	p.Close()
+	if !p.IsClosed() {
+		t.Errorf("IsClosed error. Expecting true after Close()")
+	}
+}
+
+func TestPool_HasIdle(t *testing.T) {
+	p, _ := NewChannelPool(1, MaximumCap, newStubFactory())
+
+	if !p.HasIdle() {
+		t.Errorf("HasIdle error. Expecting an idle rconn")
+	}
+
+	rconn, _ := p.Get()
+	if p.HasIdle() {
+		t.Errorf("HasIdle error. Expecting no idle rconn once drained")
+	}
+
+	rconn.Close()
+	if !p.HasIdle() {
+		t.Errorf("HasIdle error. Expecting an idle rconn once returned")
+	}
+
+	p.Close()
+	if p.HasIdle() {
+		t.Errorf("HasIdle error. Expecting no idle rconn once closed")
+	}
+}
+
+func TestPool_Available(t *testing.T) {
+	p, _ := NewChannelPool(0, 3, newStubFactory())
+
+	if p.Available() != 3 {
+		t.Errorf("Available error. Expecting %d, got %d", 3, p.Available())
+	}
+
+	rconns := make([]RpcAble, 4)
+	for i := range rconns {
+		rconns[i], _ = p.Get()
+		expected := 3 - (i + 1)
+		if expected < 0 {
+			expected = 0
+		}
+		if p.Available() != expected {
+			t.Errorf("Available error. Expecting %d, got %d", expected, p.Available())
+		}
+	}
+
+	rconns[0].Close()
+	rconns[1].Close()
+	if p.Available() != 1 {
+		t.Errorf("Available error. Expecting %d, got %d", 1, p.Available())
+	}
+
+	p.Close()
+	if p.Available() != 0 {
+		t.Errorf("Available error. Expecting %d, got %d", 0, p.Available())
+	}
+}
+
+func TestPool_FactoryContext(t *testing.T) {
+	type ctxKey struct{}
+	var got interface{}
+	p, err := NewChannelPoolContext(0, MaximumCap, func(ctx context.Context) (RpcAble, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		got = ctx.Value(ctxKey{})
+		return &stubRconn{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, 42))
+	rconn, err := p.GetContext(ctx)
+	if err != nil {
+		t.Fatalf("GetContext error: %s", err)
+	}
+	rconn.Close()
+	if got != 42 {
+		t.Errorf("GetContext error. Context not passed to factory, got %v", got)
+	}
+
+	cancel()
+	p.Get() // empty the pool
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("GetContext error. Expecting context.Canceled, got %v", err)
+	}
+
+	// the context is cancelled while the factory runs
+	dialing := make(chan struct{})
+	p, err = NewChannelPoolContext(0, MaximumCap, func(ctx context.Context) (RpcAble, error) {
+		close(dialing)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		<-dialing
+		cancel()
+	}()
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("GetContext error. Expecting context.Canceled from factory, got %v", err)
+	}
+}
+
+func TestPool_Grow(t *testing.T) {
+	failAfter := 4
+	stubFactory := newStubFactory()
+	p, err := NewChannelPool(2, 6, func() (RpcAble, error) {
+		rconn, _ := stubFactory()
+		if rconn.(*stubRconn).id > failAfter {
+			return nil, errors.New("backend down")
+		}
+		return rconn, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Grow(2); err != nil {
+		t.Fatalf("Grow error: %s", err)
+	}
+	if p.Len() != 4 {
+		t.Errorf("Grow error. Expecting %d, got %d", 4, p.Len())
+	}
+
+	// factory fails on the first new rconn
+	if err := p.Grow(1); err == nil {
+		t.Errorf("Grow error. Expecting a factory error")
+	}
+
+	// capped to maxCap
+	failAfter = 100
+	if err := p.Grow(10); err != nil {
+		t.Fatalf("Grow error: %s", err)
+	}
+	if p.Len() != 6 {
+		t.Errorf("Grow error. Expecting %d, got %d", 6, p.Len())
+	}
+
+	p.Close()
+	if err := p.Grow(1); err != ErrClosed {
+		t.Errorf("Grow error. Expecting ErrClosed, got %v", err)
+	}
+}
+
+func TestPool_Shrink(t *testing.T) {
+	var onClose int32
+	p, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory(),
+		WithOnClose(func(RpcAble) { atomic.AddInt32(&onClose, 1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rconn, _ := p.Get()
+	defer rconn.Close()
+
+	if n := p.Shrink(3); n != 3 {
+		t.Errorf("Shrink error. Expecting %d closed, got %d", 3, n)
+	}
+	if p.Len() != InitialCap-4 {
+		t.Errorf("Shrink error. Expecting %d, got %d", InitialCap-4, p.Len())
+	}
+	if stats := p.Stats(); stats.Closed != 3 || stats.InUse != 1 {
+		t.Errorf("Shrink error. Unexpected stats: %+v", stats)
+	}
+	if atomic.LoadInt32(&onClose) != 3 {
+		t.Errorf("Shrink error. Expecting %d OnClose calls, got %d", 3, onClose)
+	}
+
+	// fewer idle rconns than requested
+	if n := p.Shrink(10); n != InitialCap-4 {
+		t.Errorf("Shrink error. Expecting %d closed, got %d", InitialCap-4, n)
+	}
+
+	p.Close()
+	if n := p.Shrink(1); n != 0 {
+		t.Errorf("Shrink error. Expecting %d closed, got %d", 0, n)
+	}
+}
+
+func TestPool_GetCloseRace(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		p, _ := NewChannelPool(0, 5, newStubFactory())
+
+		var wg sync.WaitGroup
+		for _, get := range []func() (Conn, error){
+			p.Get,
+			func() (Conn, error) { return p.GetContext(context.Background()) },
+			func() (Conn, error) {
+				return p.GetValidated(func(RpcAble) bool { return true })
+			},
+		} {
+			wg.Add(1)
+			go func(get func() (Conn, error)) {
+				defer wg.Done()
+				for k := 0; k < 10; k++ {
+					rconn, err := get()
+					if err != nil {
+						if err != ErrClosed {
+							t.Errorf("Get error: %s", err)
+						}
+						return
+					}
+					rconn.Close()
+				}
+			}(get)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Grow(2); err != nil && err != ErrClosed {
+				t.Errorf("Grow error: %s", err)
+			}
+		}()
+
+		p.Close()
+		wg.Wait()
+	}
+}
+
+func TestPool_PutCloseRace(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		factory := newStubFactory()
+		p, _ := NewChannelPool(5, 5, factory, WithReturnToFront(i%2 == 0))
+
+		var wg sync.WaitGroup
+		for k := 0; k < 4; k++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for {
+					rconn, err := p.Get()
+					if err != nil {
+						return
+					}
+					rconn.Close()
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					rconn, _ := factory()
+					if err := p.Put(rconn); err == ErrClosed {
+						return
+					}
+				}
+			}()
+		}
+
+		p.Close()
+		wg.Wait()
+		if n := p.Len(); n != 0 {
+			t.Errorf("Close error. Expecting %d idle, got %d", 0, n)
+		}
+	}
+}
+
+func TestPool_NilFactory(t *testing.T) {
+	if _, err := NewChannelPool(0, 5, nil); err == nil {
+		t.Errorf("NewChannelPool error. Expecting an error for a nil factory")
+	}
+	if _, err := NewChannelPoolContext(0, 5, nil); err == nil {
+		t.Errorf("NewChannelPoolContext error. Expecting an error for a nil factory")
+	}
+}
+
+func TestPool_NoFactory(t *testing.T) {
+	p, err := NewChannelPool(0, 2, nil, WithNoFactory(), WithMinIdle(1))
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Close()
+
+	if _, err := p.Get(); err != ErrNoIdle {
+		t.Errorf("Get error. Expecting %v, got %v", ErrNoIdle, err)
+	}
+	if err := p.Grow(1); err == nil {
+		t.Errorf("Grow error. Expecting an error")
+	}
+
+	// adopted rconns are handed out
+	stub := &stubRconn{id: 42}
+	if err := p.Put(stub); err != nil {
+		t.Fatalf("Put error: %s", err)
+	}
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if rconn.(*PoolRconn).RpcAble != stub {
+		t.Errorf("Get error. Expecting the adopted rconn")
+	}
+	rconn.Close()
+	if stats := p.Stats(); stats.Idle != 1 || stats.Created != 1 {
+		t.Errorf("NoFactory error. Expecting %d idle and %d created, got %+v", 1, 1, stats)
+	}
+
+	// an initial capacity cannot be honored
+	if _, err := NewChannelPool(1, 2, nil, WithNoFactory()); !errors.Is(err, ErrNoFactory) {
+		t.Errorf("NewChannelPool error. Expecting %v, got %v", ErrNoFactory, err)
+	}
+}
+
+func TestPool_CloseContext(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	blocking := &blockingRconn{unblock: unblock}
+	p, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(blocking)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = p.CloseContext(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CloseContext error. Took too long: %s", elapsed)
+	}
+
+	closeErr, ok := err.(*CloseError)
+	if !ok {
+		t.Fatalf("CloseContext error. Expecting a *CloseError, got %v", err)
+	}
+	if closeErr.Err != context.DeadlineExceeded {
+		t.Errorf("CloseContext error. Expecting DeadlineExceeded, got %v", closeErr.Err)
+	}
+	if len(closeErr.Pending) != 1 || closeErr.Pending[0] != blocking {
+		t.Errorf("CloseContext error. Expecting the blocking rconn pending, got %v",
+			closeErr.Pending)
+	}
+
+	if _, err := p.Get(); err != ErrClosed {
+		t.Errorf("Get error. Expecting ErrClosed, got %v", err)
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	p, _ := newChannelPool()
+	pipe := make(chan RpcAble, 0)
+
+	go func() {
+		p.Close()
+	}()
+
+	for i := 0; i < MaximumCap; i++ {
+		go func() {
+			rconn, _ := p.Get()
+
+			pipe <- rconn
+		}()
+
+		go func() {
+			rconn := <-pipe
+			if rconn == nil {
+				return
+			}
+			rconn.Close()
+		}()
+	}
+}
+
+//func TestPoolWriteRead(t *testing.T) {
+//	p, _ := NewChannelPool(0, 30, factory)
+//
+//	rconn, _ := p.Get()
+//
+//	conn := rconn.(net.Conn)
+//
+//	msg := "hello"
+//	_, err := conn.Write([]byte(msg))
+//	if err != nil {
+//		t.Error(err)
+//	}
+//}
+
+func TestPoolConcurrent2(t *testing.T) {
+	p, _ := NewChannelPool(0, 30, factory)
+
+	var wg sync.WaitGroup
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				rconn, _ := p.Get()
+				time.Sleep(time.Millisecond * time.Duration(rand.Intn(100)))
+				rconn.Close()
+				wg.Done()
+			}(i)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			rconn, _ := p.Get()
+			time.Sleep(time.Millisecond * time.Duration(rand.Intn(100)))
+			rconn.Close()
+			wg.Done()
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestPool_StatsLogging(t *testing.T) {
+	fc := newFakeClock()
+	logger := &testLogger{}
+	p, _ := NewChannelPool(2, 5, newStubFactory(), withClock(fc),
+		WithLogger(logger), WithStatsLogging(time.Minute))
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	defer rconn.Close()
+
+	for i := 1; i <= 3; i++ {
+		fc.BlockUntil(1) // waiting for the next interval
+		if n := logger.count(); n != i-1 {
+			t.Fatalf("StatsLogging error. Expecting %d lines, got %d", i-1, n)
+		}
+		fc.Advance(time.Minute)
+		deadline := time.Now().Add(time.Second)
+		for logger.count() != i && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if len(logger.msgs) != 3 {
+		t.Fatalf("StatsLogging error. Expecting %d lines, got %d", 3, len(logger.msgs))
+	}
+	const expected = "pool: stats open=2 idle=1 in_use=1 waiters=0 waits=0 exhausted=0 created=2 closed=0 dial_error_rate=0.000"
+	for _, msg := range logger.msgs {
+		if msg != expected {
+			t.Errorf("StatsLogging error. Expecting %q, got %q", expected, msg)
+		}
+	}
+}
+
+// testLogger is a Logger recording messages.
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+	l.mu.Unlock()
+}
+
+func (l *testLogger) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.msgs)
+}
+
+// stubRconn is a RpcAble not connected to anything.
+type stubRconn struct {
+	id      int
+	mu      sync.Mutex
+	closed  int
+	calls   []string
+	callErr error
+}
+
+func (s *stubRconn) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, serviceMethod)
+	return s.callErr
+}
+
+func (s *stubRconn) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.calls)
+}
+
+func (s *stubRconn) Go(serviceMethod string, args interface{}, reply interface{}, done chan *rpc.Call) *rpc.Call {
+	call := &rpc.Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+	if call.Done == nil {
+		call.Done = make(chan *rpc.Call, 1)
+	}
+	call.Done <- call
+	return call
+}
+
+func (s *stubRconn) Close() error {
+	s.mu.Lock()
+	s.closed++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *stubRconn) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed > 0
+}
+
+// blockingRconn is a stubRconn whose Close() blocks until unblock is
+// closed.
+type blockingRconn struct {
+	stubRconn
+	unblock chan struct{}
+}
+
+func (b *blockingRconn) Close() error {
+	<-b.unblock
+	return b.stubRconn.Close()
+}
+
+var errSlowGo = errors.New("slow go error")
+
+// slowGoRconn is a stubRconn whose Go() calls complete once unblock
+// is closed.
+type slowGoRconn struct {
+	stubRconn
+	unblock chan struct{}
+}
+
+func (s *slowGoRconn) Go(serviceMethod string, args interface{}, reply interface{}, done chan *rpc.Call) *rpc.Call {
+	call := &rpc.Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+	go func() {
+		<-s.unblock
+		call.Error = errSlowGo
+		call.Done <- call
+	}()
+	return call
+}
+
+// newStubFactory returns a factory creating stubRconn instances
+// numbered from 1.
+func newStubFactory() Factory {
+	var mu sync.Mutex
+	id := 0
+	return func() (RpcAble, error) {
+		mu.Lock()
+		id++
+		rconn := &stubRconn{id: id}
+		mu.Unlock()
+		return rconn, nil
+	}
 }
 
 func newChannelPool() (Pool, error) {
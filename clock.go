@@ -0,0 +1,40 @@
+package pool
+
+import "time"
+
+// clock abstracts the time functions used by the pool, so tests can
+// control time instead of sleeping.
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) timer
+}
+
+// timer is the part of *time.Timer used by the pool.
+type timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// realClock is the default clock, relying on the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// since returns the time elapsed since t according to the pool clock.
+func (c *channelPool) since(t time.Time) time.Duration {
+	return c.clock.Now().Sub(t)
+}
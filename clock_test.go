@@ -0,0 +1,125 @@
+package pool
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock only moving forward when advanced, firing the
+// timers due at that time.
+type fakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	fc := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+// withClock makes the pool use clk instead of the time package.
+func withClock(clk clock) Option {
+	return func(c *channelPool) {
+		c.clock = clk
+	}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) NewTimer(d time.Duration) timer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	t := &fakeTimer{clock: fc, deadline: fc.now.Add(d), c: make(chan time.Time, 1)}
+	fc.timers = append(fc.timers, t)
+	fc.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d and fires the timers due.
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+	pending := fc.timers[:0]
+	for _, t := range fc.timers {
+		if t.deadline.After(fc.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- fc.now
+		}
+	}
+	fc.timers = pending
+}
+
+// BlockUntil waits for n timers to be pending.
+func (fc *fakeClock) BlockUntil(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for len(fc.timers) < n {
+		fc.cond.Wait()
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	fc := t.clock
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for i, o := range fc.timers {
+		if o == t {
+			fc.timers = append(fc.timers[:i], fc.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestPool_FakeClock(t *testing.T) {
+	fc := newFakeClock()
+	p, _ := NewChannelPool(2, 2, newStubFactory(), withClock(fc))
+	defer p.Close()
+	events := p.Events()
+
+	rconn, _ := p.Get()
+	fc.Advance(time.Hour)
+	if age := rconn.Age(); age != time.Hour {
+		t.Errorf("Age error. Expecting %s, got %s", time.Hour, age)
+	}
+	rconn.Close()
+
+	p.SetConnMaxLifetime(2 * time.Hour)
+	fc.BlockUntil(1) // reaper waiting for the reap interval
+	fc.Advance(2 * time.Hour)
+
+	// both rconns are now 3 hours old, so reaped
+	for reaped := 0; reaped < 2; {
+		select {
+		case ev := <-events:
+			if ev.Kind == EventReaped {
+				reaped++
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Reaper error. Expecting rconns to be reaped")
+		}
+	}
+	if stats := p.Stats(); stats.MaxLifetimeClosed != 2 || stats.Idle != 0 {
+		t.Errorf("Reaper error. Expecting %d reaped and no idle, got %+v", 2, stats)
+	}
+}
@@ -0,0 +1,143 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Config is a read-only snapshot of the effective configuration of a
+// pool, as returned by Pool.Config(), including the changes made at
+// runtime by the setters.
+type Config struct {
+	// InitialCap and MaxCap are the capacities the pool was created
+	// with.
+	InitialCap int
+	MaxCap     int
+
+	// MaxIdle is the WithMaxIdle() or SetMaxIdleConns() limit, MaxCap
+	// by default.
+	MaxIdle int
+	// MaxOpen is the SetMaxOpenConns() limit, 0 if unlimited. If not
+	// 0, Get() blocks once it is reached.
+	MaxOpen int
+	// MaxLifetime is the SetConnMaxLifetime() duration, 0 if disabled.
+	MaxLifetime time.Duration
+	// MaxIdleTime is the SetConnMaxIdleTime() duration, 0 if
+	// disabled.
+	MaxIdleTime time.Duration
+
+	// MinIdle is the WithMinIdle() setting.
+	MinIdle int
+	// SoftCap is the WithSoftCap() setting, 0 if disabled.
+	SoftCap int
+	// OverflowAllowance is the WithOverflowAllowance() setting, 0 if
+	// disabled.
+	OverflowAllowance int
+	// MaxWaiters is the WithMaxWaiters() setting, 0 if unlimited.
+	MaxWaiters int
+	// SharedLimiter is the WithSharedLimiter() limiter, nil if none.
+	SharedLimiter *Limiter
+	// FullPolicy is the WithFullPolicy() setting.
+	FullPolicy FullPolicy
+	// FillTolerance is the WithFillTolerance() setting.
+	FillTolerance int
+	// DialTimeout is the WithDialTimeout() setting, 0 if disabled.
+	DialTimeout time.Duration
+	// DialAttempts is the WithDialAttempts() setting, 1 by default.
+	DialAttempts int
+	// DialBackoff is a copy of the WithDialBackoff() backoff, its zero
+	// value if none.
+	DialBackoff Backoff
+	// MaxTotalDials is the WithMaxTotalDials() setting, 0 if
+	// unlimited.
+	MaxTotalDials int64
+	// PreferFreshAfter is the WithPreferFreshAfter() setting, 0 if
+	// disabled.
+	PreferFreshAfter time.Duration
+	// MaxCumulativeUseTime is the WithMaxCumulativeUseTime() setting,
+	// 0 if disabled.
+	MaxCumulativeUseTime time.Duration
+	// HealthSweepInterval is the WithHealthSweep() interval, 0 if
+	// disabled.
+	HealthSweepInterval time.Duration
+	// StatsInterval is the WithStatsLogging() interval, 0 if disabled.
+	StatsInterval time.Duration
+	// IntervalJitter is the WithIntervalJitter() fraction.
+	IntervalJitter float64
+
+	// LatencyAware, AsyncClose, NoSyncDial, NoFactory,
+	// FillValidation, ReturnToFront and EagerReplace are true if the
+	// corresponding options are set.
+	LatencyAware   bool
+	AsyncClose     bool
+	NoSyncDial     bool
+	NoFactory      bool
+	FillValidation bool
+	ReturnToFront  bool
+	EagerReplace   bool
+	// Failover is true if a WithFailoverFactory() factory is set.
+	Failover bool
+	// PingIdle is true if a WithPingIfIdleLongerThan() ping is set,
+	// PingIdleAfter being its idle duration.
+	PingIdle      bool
+	PingIdleAfter time.Duration
+	// Prime is true if a WithPrime() setup is set, RePrime if
+	// WithRePrime() is set too.
+	Prime   bool
+	RePrime bool
+	// Paused is true if the pool is paused, see Pool.Pause().
+	Paused bool
+}
+
+// Config implements the Pool interfaces Config() method.
+func (c *channelPool) Config() Config {
+	c.mu.Lock()
+	maxIdle := c.maxIdle
+	c.mu.Unlock()
+
+	var dialBackoff Backoff
+	if c.dialBackoff != nil {
+		dialBackoff = *c.dialBackoff
+	}
+
+	return Config{
+		InitialCap: c.initialCap,
+		MaxCap:     c.maxCap,
+
+		MaxIdle:     maxIdle,
+		MaxOpen:     int(atomic.LoadInt64(&c.maxOpen)),
+		MaxLifetime: time.Duration(atomic.LoadInt64(&c.maxLifetime)),
+		MaxIdleTime: time.Duration(atomic.LoadInt64(&c.maxIdleTime)),
+
+		MinIdle:              c.minIdle,
+		SoftCap:              int(c.softCap),
+		OverflowAllowance:    int(c.overflowAllowance),
+		MaxWaiters:           int(c.maxWaiters),
+		SharedLimiter:        c.limiter,
+		FullPolicy:           c.fullPolicy,
+		FillTolerance:        c.fillTolerance,
+		DialTimeout:          c.dialTimeout,
+		DialAttempts:         c.dialAttempts,
+		DialBackoff:          dialBackoff,
+		MaxTotalDials:        c.maxTotalDials,
+		PreferFreshAfter:     c.preferFreshAfter,
+		MaxCumulativeUseTime: c.maxUseTime,
+		HealthSweepInterval:  c.sweepInterval,
+		StatsInterval:        c.statsInterval,
+		IntervalJitter:       c.intervalJitter,
+
+		LatencyAware:   c.latencyAware,
+		AsyncClose:     c.asyncClose,
+		NoSyncDial:     c.noSyncDial,
+		NoFactory:      c.noFactory,
+		FillValidation: c.fillValidation,
+		ReturnToFront:  c.returnToFront,
+		EagerReplace:   c.eagerReplace,
+		Failover:       c.failover != nil,
+		PingIdle:       c.pingIdle != nil,
+		PingIdleAfter:  c.pingIdleAfter,
+		Prime:          c.prime != nil,
+		RePrime:        c.prime != nil && c.rePrime,
+		Paused:         c.isPaused(),
+	}
+}
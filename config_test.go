@@ -0,0 +1,73 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPool_Config(t *testing.T) {
+	limiter := NewLimiter(100)
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory(),
+		WithMinIdle(1),
+		WithSoftCap(10),
+		WithMaxWaiters(5),
+		WithSharedLimiter(limiter),
+		WithFullPolicy(FullPolicyEvictOldest),
+		WithDialTimeout(time.Second),
+		WithDialAttempts(3),
+		WithDialBackoff(&Backoff{Base: time.Millisecond, Factor: 2}),
+		WithNoSyncDial(true),
+		WithReturnToFront(true),
+		WithStatsLogging(time.Hour),
+		WithPrime(func(context.Context, RpcAble) error { return nil }),
+		WithRePrime(true),
+		WithEagerReplace(true),
+		WithPingIfIdleLongerThan(time.Minute, func(RpcAble) error { return nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	expected := Config{
+		InitialCap:    2,
+		MaxCap:        MaximumCap,
+		MaxIdle:       MaximumCap,
+		MinIdle:       1,
+		SoftCap:       10,
+		MaxWaiters:    5,
+		SharedLimiter: limiter,
+		FullPolicy:    FullPolicyEvictOldest,
+		DialTimeout:   time.Second,
+		DialAttempts:  3,
+		DialBackoff:   Backoff{Base: time.Millisecond, Factor: 2},
+		NoSyncDial:    true,
+		StatsInterval: time.Hour,
+		ReturnToFront: true,
+		EagerReplace:  true,
+		PingIdle:      true,
+		PingIdleAfter: time.Minute,
+		Prime:         true,
+		RePrime:       true,
+	}
+	if config := p.Config(); config != expected {
+		t.Errorf("Config error. Expecting %+v, got %+v", expected, config)
+	}
+
+	// runtime changes
+	p.SetMaxIdleConns(4)
+	p.SetMaxOpenConns(8)
+	p.SetConnMaxLifetime(time.Minute)
+	p.SetConnMaxIdleTime(time.Second)
+	p.Pause()
+	defer p.Resume()
+
+	expected.MaxIdle = 4
+	expected.MaxOpen = 8
+	expected.MaxLifetime = time.Minute
+	expected.MaxIdleTime = time.Second
+	expected.Paused = true
+	if config := p.Config(); config != expected {
+		t.Errorf("Config error. Expecting %+v, got %+v", expected, config)
+	}
+}
@@ -1,7 +1,12 @@
 package pool
 
 import (
+	"errors"
+	"io"
+	"net"
 	"net/rpc"
+	"sync/atomic"
+	"time"
 )
 
 type RpcAble interface {
@@ -10,23 +15,246 @@ type RpcAble interface {
 	Close() error
 }
 
+// Drainable is an optional interface RPC-able connections can
+// implement to flush their pending calls before being closed. The
+// pool calls Drain() just before closing them, whatever the reason.
+type Drainable interface {
+	Drain() error
+}
+
+// Addressable is an optional interface RPC-able connections can
+// implement to expose the address of their remote side, then
+// available through Conn.RemoteAddr().
+type Addressable interface {
+	RemoteAddr() net.Addr
+}
+
+// Sticky is an optional interface RPC-able connections can implement
+// to opt out of the SetConnMaxLifetime() and SetConnMaxIdleTime()
+// policies, typically the ones expensive to establish. Those for which
+// Sticky() returns true are never reaped nor closed for their age.
+type Sticky interface {
+	Sticky() bool
+}
+
+// isSticky returns true if rconn implements Sticky and is sticky.
+func isSticky(rconn RpcAble) bool {
+	s, ok := rconn.(Sticky)
+	return ok && s.Sticky()
+}
+
+// IdleLimited is an optional interface RPC-able connections can
+// implement to have their own maximum idle time, overriding the
+// SetConnMaxIdleTime() one, for example to keep the connections to a
+// premium backend longer. A non-positive IdleTTL() falls back to the
+// pool one. It is called each time the RPC-able connection is
+// created, adopted or checked by the reaper, so it can change over
+// time.
+type IdleLimited interface {
+	IdleTTL() time.Duration
+}
+
+// idleTTL returns the own maximum idle time of rconn, 0 if none.
+func idleTTL(rconn RpcAble) time.Duration {
+	if l, ok := rconn.(IdleLimited); ok {
+		if ttl := l.IdleTTL(); ttl > 0 {
+			return ttl
+		}
+	}
+	return 0
+}
+
+// Conn is the RPC-able connection returned by Pool.Get(). Closing it
+// puts it back to the pool.
+type Conn interface {
+	RpcAble
+
+	// MarkUnusable marks the connection not usable any more, to let
+	// the pool close it instead of returning it to pool.
+	MarkUnusable()
+
+	// Release is an alias of Close() making explicit the RPC-able
+	// connection is put back to the pool and not closed.
+	Release() error
+
+	// TryRelease puts the connection back to the pool as Release()
+	// does, and reports whether it really went back to the idle set.
+	// accepted is false if the connection was closed instead, because
+	// it was marked unusable or the pool is full or closed.
+	TryRelease() (accepted bool, err error)
+
+	// CallOrRetire calls Call() and marks the connection unusable if
+	// it fails with a transport error, as rpc.ErrShutdown,
+	// io.ErrUnexpectedEOF or a network error, so its next Close()
+	// retires it. An application error returned by the server keeps
+	// it usable. If the pool has a WithRetireOn() predicate, it is
+	// used instead to classify the error.
+	CallOrRetire(serviceMethod string, args, reply interface{}) error
+
+	// Age returns the time elapsed since the underlying RPC-able
+	// connection was created.
+	Age() time.Duration
+
+	// Uses returns the number of times the underlying RPC-able
+	// connection has been checked out from the pool, including the
+	// current one.
+	Uses() int
+
+	// AvgLatency returns the exponentially-weighted moving average of
+	// the Call() durations on the underlying RPC-able connection, or 0
+	// if no call has been made yet.
+	AvgLatency() time.Duration
+
+	// Meta returns the metadata returned by the FactoryWithMeta
+	// factory along with the underlying RPC-able connection, or nil.
+	// It must not be modified.
+	Meta() map[string]string
+
+	// LastError returns the last error returned by Call() on the
+	// underlying RPC-able connection, whatever the checkout, or nil.
+	LastError() error
+
+	// RemoteAddr returns the remote address of the underlying RPC-able
+	// connection and true if it implements Addressable, nil and false
+	// otherwise.
+	RemoteAddr() (net.Addr, bool)
+}
+
 // PoolRconn is a wrapper around RpcAble to modify the behavior of
 // RpcAble's Close() method.
+//
+// A new PoolRconn is returned by each checkout, so once closed, a
+// PoolRconn is definitely detached from its RPC-able connection and
+// fails cleanly if used.
 type PoolRconn struct {
 	RpcAble
 	c        *channelPool
+	entry    *rconnEntry
 	unusable bool
+	closed   bool
+	// GetForKey() key, if any
+	key string
+	// GetLabeled() label, if any
+	label string
 }
 
+// errRconnClosed is the error returned when a closed PoolRconn is used.
+var errRconnClosed = errors.New("rconn is already closed")
+
 // Close() puts the given rconn back to the pool instead of closing it.
-func (p PoolRconn) Close() error {
+func (p *PoolRconn) Close() error {
+	_, err := p.TryRelease()
+	return err
+}
+
+// TryRelease implements the Conn interface.
+func (p *PoolRconn) TryRelease() (bool, error) {
+	if p.closed {
+		return false, errRconnClosed
+	}
+
+	var (
+		accepted bool
+		err      error
+	)
+	p.c.checkSaturation(atomic.AddInt64(&p.c.inUse, -1))
+	p.c.emitLabel(EventReturned, p.label)
 	if p.unusable {
 		if p.RpcAble != nil {
-			return p.RpcAble.Close()
+			p.c.emit(EventDiscarded)
+			err = p.c.discardRetired(p.entry)
 		}
-		return nil
+	} else if p.c.usedUp(p.entry) {
+		p.c.emit(EventReaped)
+		err = p.c.discardRetired(p.entry)
+	} else {
+		if p.key != "" {
+			p.c.setAffinity(p.key, p.entry)
+		}
+		accepted, err = p.c.put(p.entry)
+	}
+
+	// detach the wrapper, so a stale use cannot reach the rconn
+	// anymore, now possibly checked out by another caller. As wrappers
+	// are never reused, there is no need to recycle them.
+	*p = PoolRconn{closed: true}
+
+	return accepted, err
+}
+
+// Call calls the underlying RPC-able connection Call() method,
+// recording its duration.
+func (p *PoolRconn) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	if p.closed {
+		return errRconnClosed
 	}
-	return p.c.put(p.RpcAble)
+
+	start := p.c.clock.Now()
+	err := p.RpcAble.Call(serviceMethod, args, reply)
+	p.c.recordLatency(p.entry, p.c.since(start))
+	if err != nil {
+		p.entry.lastErr.Store(&lastError{err: err})
+	}
+	return err
+}
+
+// CallOrRetire implements the Conn interface.
+func (p *PoolRconn) CallOrRetire(serviceMethod string, args, reply interface{}) error {
+	err := p.Call(serviceMethod, args, reply)
+	if err == nil || err == errRconnClosed {
+		return err
+	}
+
+	retire := p.c.retireOn
+	if retire == nil {
+		retire = isTransportError
+	}
+	if retire(err) {
+		p.MarkUnusable()
+	}
+	return err
+}
+
+// isTransportError returns true if err comes from the transport
+// layer, and not from the remote side as a rpc.ServerError.
+func isTransportError(err error) bool {
+	var serverErr rpc.ServerError
+	if errors.As(err, &serverErr) {
+		return false
+	}
+	var netErr net.Error
+	return isShutdown(err) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// Release implements the Conn interface.
+func (p *PoolRconn) Release() error {
+	return p.Close()
+}
+
+// Go calls the underlying RPC-able connection Go() method. If p is
+// closed, the returned call fails immediately.
+func (p *PoolRconn) Go(serviceMethod string, args interface{}, reply interface{}, done chan *rpc.Call) *rpc.Call {
+	if !p.closed {
+		return p.RpcAble.Go(serviceMethod, args, reply, done)
+	}
+
+	if done == nil {
+		done = make(chan *rpc.Call, 1)
+	}
+	call := &rpc.Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Error:         errRconnClosed,
+		Done:          done,
+	}
+	select {
+	case done <- call:
+	default:
+		// as net/rpc, don't block on an unbuffered done channel
+	}
+	return call
 }
 
 // MarkUnusable() marks the rconn not usable any more, to let the
@@ -35,10 +263,80 @@ func (p *PoolRconn) MarkUnusable() {
 	p.unusable = true
 }
 
-// wrapRconn wraps a standard RpcAble to a PoolRconn RpcAble.
-func (c *channelPool) wrapRconn(rconn RpcAble) RpcAble {
-	return &PoolRconn{
-		RpcAble: rconn,
+// Age implements the Conn interface.
+// It returns 0 if p is closed.
+func (p *PoolRconn) Age() time.Duration {
+	if p.closed {
+		return 0
+	}
+	return p.c.since(p.entry.createdAt)
+}
+
+// Uses implements the Conn interface. It returns 0 if p is closed.
+func (p *PoolRconn) Uses() int {
+	if p.closed {
+		return 0
+	}
+	return p.entry.uses
+}
+
+// AvgLatency implements the Conn interface. It returns 0 if p is
+// closed.
+func (p *PoolRconn) AvgLatency() time.Duration {
+	if p.closed {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&p.entry.avgLatency))
+}
+
+// Meta implements the Conn interface. It returns nil if p is closed.
+func (p *PoolRconn) Meta() map[string]string {
+	if p.closed {
+		return nil
+	}
+	return p.entry.meta
+}
+
+// LastError implements the Conn interface. It returns nil if p is
+// closed.
+func (p *PoolRconn) LastError() error {
+	if p.closed {
+		return nil
+	}
+	return p.entry.lastError()
+}
+
+// RemoteAddr implements the Conn interface. It returns nil and false
+// if p is closed.
+func (p *PoolRconn) RemoteAddr() (net.Addr, bool) {
+	if p.closed {
+		return nil, false
+	}
+	if a, ok := p.RpcAble.(Addressable); ok {
+		return a.RemoteAddr(), true
+	}
+	return nil, false
+}
+
+// wrapRconn wraps the standard RpcAble of e to a PoolRconn RpcAble,
+// for a checkout labeled by label, see GetLabeled().
+func (c *channelPool) wrapRconn(e *rconnEntry, label string) *PoolRconn {
+	c.checkSaturation(atomic.AddInt64(&c.inUse, 1))
+	c.forgetAffinity(e)
+	e.uses++
+	if c.maxUseTime > 0 {
+		e.checkedOutAt = c.clock.Now()
+	}
+	c.emitLabel(EventCheckedOut, label)
+
+	p := &PoolRconn{
+		RpcAble: e.rconn,
 		c:       c,
+		entry:   e,
+		label:   label,
+	}
+	if c.onGet != nil {
+		c.safeCall("OnGet hook", func() { c.onGet(p, label) })
 	}
+	return p
 }
@@ -1,9 +1,374 @@
 package pool
 
 import (
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRconn_Impl(t *testing.T) {
 	var _ RpcAble = new(PoolRconn)
+	var _ Conn = new(PoolRconn)
+}
+
+// drainableRconn is a stubRconn recording its Drain() and Close()
+// calls order.
+type drainableRconn struct {
+	stubRconn
+	mu    sync.Mutex
+	calls []string
+}
+
+func (d *drainableRconn) Drain() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, "Drain")
+	return nil
+}
+
+func (d *drainableRconn) Close() error {
+	d.mu.Lock()
+	d.calls = append(d.calls, "Close")
+	d.mu.Unlock()
+	return d.stubRconn.Close()
+}
+
+func (d *drainableRconn) order() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return strings.Join(d.calls, ",")
+}
+
+func TestRconn_Drainable(t *testing.T) {
+	var rconns []*drainableRconn
+	p, err := NewChannelPool(2, MaximumCap, func() (RpcAble, error) {
+		rconn := &drainableRconn{}
+		rconns = append(rconns, rconn)
+		return rconn, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unusable
+	rconn, _ := p.Get()
+	rconn.MarkUnusable()
+	rconn.Close()
+	if order := rconns[0].order(); order != "Drain,Close" {
+		t.Errorf("Drainable error. Expecting Drain,Close, got %s", order)
+	}
+
+	// pool shutdown
+	p.Close()
+	if order := rconns[1].order(); order != "Drain,Close" {
+		t.Errorf("Drainable error. Expecting Drain,Close, got %s", order)
+	}
+}
+
+func TestRconn_AgeUses(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	if rconn.Uses() != 1 {
+		t.Errorf("Uses error. Expecting %d, got %d", 1, rconn.Uses())
+	}
+	time.Sleep(10 * time.Millisecond)
+	rconn.Close()
+
+	rconn, _ = p.Get()
+	defer rconn.Close()
+	if rconn.Uses() != 2 {
+		t.Errorf("Uses error. Expecting %d, got %d", 2, rconn.Uses())
+	}
+	if age := rconn.Age(); age < 10*time.Millisecond || age > time.Minute {
+		t.Errorf("Age error. Unexpected age %s", age)
+	}
+}
+
+func TestRconn_Recycled(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	rconn.(*PoolRconn).MarkUnusable()
+	rconn.Close()
+
+	if err := rconn.Close(); err == nil {
+		t.Errorf("Close error. A second Close() should fail")
+	}
+
+	for i := 0; i < 10; i++ {
+		rconn, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+
+		pc := rconn.(*PoolRconn)
+		if pc.unusable || pc.closed || pc.RpcAble == nil || pc.entry == nil {
+			t.Errorf("Get error. Stale state leaked: %+v", pc)
+		}
+		rconn.Close()
+	}
+
+	if p.Len() != 1 {
+		t.Errorf("Close error. Expecting %d, got %d", 1, p.Len())
+	}
+}
+
+func TestRconn_Release(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	if err := rconn.Release(); err != nil {
+		t.Errorf("Release error: %s", err)
+	}
+	if p.Len() != 1 {
+		t.Errorf("Release error. Expecting %d, got %d", 1, p.Len())
+	}
+	if err := rconn.Release(); err == nil {
+		t.Errorf("Release error. A second Release() should fail")
+	}
+}
+
+func TestRconn_TryRelease(t *testing.T) {
+	p, _ := NewChannelPool(0, 1, newStubFactory())
+	defer p.Close()
+
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+
+	if accepted, err := rconn1.TryRelease(); !accepted || err != nil {
+		t.Errorf("TryRelease error. Expecting true, nil, got %t, %v", accepted, err)
+	}
+
+	// the pool is full
+	stub := rconn2.(*PoolRconn).RpcAble.(*stubRconn)
+	if accepted, err := rconn2.TryRelease(); accepted || err != nil {
+		t.Errorf("TryRelease error. Expecting false, nil, got %t, %v", accepted, err)
+	}
+	if !stub.isClosed() {
+		t.Errorf("TryRelease error. Expecting the rconn to be closed")
+	}
+
+	// unusable
+	rconn, _ := p.Get()
+	rconn.MarkUnusable()
+	if accepted, _ := rconn.TryRelease(); accepted {
+		t.Errorf("TryRelease error. Expecting an unusable rconn not to be accepted")
+	}
+
+	if accepted, err := rconn.TryRelease(); accepted || err != errRconnClosed {
+		t.Errorf("TryRelease error. Expecting false, %v, got %t, %v", errRconnClosed, accepted, err)
+	}
+	if p.Len() != 0 {
+		t.Errorf("TryRelease error. Expecting %d, got %d", 0, p.Len())
+	}
+}
+
+func TestRconn_CallOrRetire(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	// application error
+	rconn, _ := p.Get()
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	stub.callErr = rpc.ServerError("invalid argument")
+	if err := rconn.CallOrRetire("Svc.Method", nil, nil); err != stub.callErr {
+		t.Errorf("CallOrRetire error. Expecting %v, got %v", stub.callErr, err)
+	}
+	if rconn.(*PoolRconn).unusable {
+		t.Error("CallOrRetire error. An application error should keep the rconn usable")
+	}
+	rconn.Close()
+	if p.Len() != 1 || stub.isClosed() {
+		t.Fatal("CallOrRetire error. Expecting the rconn back to the pool")
+	}
+
+	// transport error
+	rconn, _ = p.Get()
+	stub.callErr = io.ErrUnexpectedEOF
+	if err := rconn.CallOrRetire("Svc.Method", nil, nil); err != io.ErrUnexpectedEOF {
+		t.Errorf("CallOrRetire error. Expecting %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+	if !rconn.(*PoolRconn).unusable {
+		t.Error("CallOrRetire error. A transport error should retire the rconn")
+	}
+	rconn.Close()
+	if p.Len() != 0 || !stub.isClosed() {
+		t.Error("CallOrRetire error. Expecting the rconn to be closed")
+	}
+}
+
+func TestRconn_StaleWrapper(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	stale, _ := p.Get()
+	stale.Close()
+
+	rconn, _ := p.Get()
+	defer rconn.Close()
+
+	// a stale Close() doesn't return the rconn checked out by another caller
+	if err := stale.Close(); err != errRconnClosed {
+		t.Errorf("Close error. Expecting %v, got %v", errRconnClosed, err)
+	}
+	if stats := p.Stats(); stats.InUse != 1 || stats.Idle != 0 {
+		t.Errorf("Close error. Stale Close() affected the pool: %+v", stats)
+	}
+
+	if err := stale.Call("Arith.Mul", nil, nil); err != errRconnClosed {
+		t.Errorf("Call error. Expecting %v, got %v", errRconnClosed, err)
+	}
+	if call := stale.Go("Arith.Mul", nil, nil, nil); call.Error != errRconnClosed {
+		t.Errorf("Go error. Expecting %v, got %v", errRconnClosed, call.Error)
+	}
+	if stale.Age() != 0 || stale.Uses() != 0 || stale.AvgLatency() != 0 {
+		t.Errorf("Stale wrapper error. Expecting zero values")
+	}
+}
+
+func BenchmarkRconn_GetClose(b *testing.B) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rconn, _ := p.Get()
+		rconn.Close()
+	}
+}
+
+func BenchmarkRconn_GetCloseParallel(b *testing.B) {
+	p, _ := NewChannelPool(MaximumCap, MaximumCap, newStubFactory())
+	defer p.Close()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rconn, _ := p.Get()
+			rconn.Close()
+		}
+	})
+}
+
+func TestRconn_Meta(t *testing.T) {
+	factory := newStubFactory()
+	p, err := NewChannelPoolWithMeta(0, 2, func() (RpcAble, map[string]string, error) {
+		rconn, err := factory()
+		return rconn, map[string]string{"region": "eu-west"}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	stub := rconn.(*PoolRconn).RpcAble
+	if region := rconn.Meta()["region"]; region != "eu-west" {
+		t.Errorf("Meta error. Expecting %q, got %q", "eu-west", region)
+	}
+	rconn.Close()
+	if meta := rconn.Meta(); meta != nil {
+		t.Errorf("Meta error. Expecting nil once closed, got %v", meta)
+	}
+
+	// metadata travel with the rconn across pool cycles
+	rconn, _ = p.Get()
+	defer rconn.Close()
+	if rconn.(*PoolRconn).RpcAble != stub {
+		t.Fatal("Meta error. Expecting the same rconn")
+	}
+	if region := rconn.Meta()["region"]; region != "eu-west" {
+		t.Errorf("Meta error. Expecting %q, got %q", "eu-west", region)
+	}
+
+	// no metadata with other factories
+	p2, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p2.Close()
+	rconn2, _ := p2.Get()
+	defer rconn2.Close()
+	if meta := rconn2.Meta(); meta != nil {
+		t.Errorf("Meta error. Expecting nil, got %v", meta)
+	}
+}
+
+func TestRconn_LastError(t *testing.T) {
+	p, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	if err := rconn.LastError(); err != nil {
+		t.Errorf("LastError error. Expecting nil, got %v", err)
+	}
+
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	callErr := errors.New("connection reset")
+	stub.callErr = callErr
+	rconn.Call("Svc.Method", nil, nil)
+	if err := rconn.LastError(); err != callErr {
+		t.Errorf("LastError error. Expecting %v, got %v", callErr, err)
+	}
+
+	// a successful call keeps the last error
+	stub.callErr = nil
+	rconn.Call("Svc.Method", nil, nil)
+	if err := rconn.LastError(); err != callErr {
+		t.Errorf("LastError error. Expecting %v, got %v", callErr, err)
+	}
+
+	// the last error travels with the rconn
+	rconn.Close()
+	if info := p.Inspect(); len(info) != 1 || info[0].LastError != callErr {
+		t.Errorf("Inspect error. Expecting LastError %v, got %+v", callErr, info)
+	}
+	rconn, _ = p.Get()
+	defer rconn.Close()
+	if err := rconn.LastError(); err != callErr {
+		t.Errorf("LastError error. Expecting %v, got %v", callErr, err)
+	}
+}
+
+// addressableRconn is a stubRconn exposing a remote address.
+type addressableRconn struct {
+	stubRconn
+	addr net.Addr
+}
+
+func (a *addressableRconn) RemoteAddr() net.Addr {
+	return a.addr
+}
+
+func TestRconn_RemoteAddr(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242}
+	p, _ := NewChannelPool(1, 1, func() (RpcAble, error) {
+		return &addressableRconn{addr: addr}, nil
+	})
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	got, ok := rconn.RemoteAddr()
+	if !ok || got.String() != "10.0.0.1:4242" {
+		t.Errorf("RemoteAddr error. Expecting 10.0.0.1:4242, got %v, %t", got, ok)
+	}
+	rconn.Close()
+	if got, ok := rconn.RemoteAddr(); ok || got != nil {
+		t.Errorf("RemoteAddr error. Expecting nil, false once closed, got %v, %t", got, ok)
+	}
+
+	// not addressable
+	p2, _ := NewChannelPool(1, 1, newStubFactory())
+	defer p2.Close()
+	rconn, _ = p2.Get()
+	defer rconn.Close()
+	if got, ok := rconn.RemoteAddr(); ok || got != nil {
+		t.Errorf("RemoteAddr error. Expecting nil, false, got %v, %t", got, ok)
+	}
 }
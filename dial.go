@@ -0,0 +1,234 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// dialErrorWeight is the weight of the newest factory call outcome in
+// the dial error rate exponentially-weighted moving average, so
+// roughly the last 1/dialErrorWeight calls are taken into account.
+const dialErrorWeight = 0.1
+
+// dial creates a new RPC-able connection using factory, within the
+// dial timeout if any, calling it up to c.dialAttempts times. If
+// factory keeps failing, the failover factory is tried, if any. If
+// ctx is done, ctx.Err() is returned whatever the factory error, so
+// callers can tell their own cancellation from the pool dial timeout.
+func (c *channelPool) dial(ctx context.Context, factory metaFactory) (*rconnEntry, error) {
+	gen := atomic.LoadUint64(&c.gen)
+
+	if c.noFactory {
+		return nil, ErrNoFactory
+	}
+	if !c.takeDial() {
+		return nil, ErrDialBudgetExhausted
+	}
+
+	rconn, meta, cleanup, err := c.create(ctx, factory, c.legacy, 0)
+	for attempt := 1; err != nil && attempt < c.dialAttempts && c.sleep(ctx, c.dialBackoff.Next(attempt-1)); attempt++ {
+		rconn, meta, cleanup, err = c.create(ctx, factory, c.legacy, attempt)
+	}
+	failover := false
+	if err != nil && c.failover != nil && ctx.Err() == nil {
+		rconn, meta, cleanup, err = c.create(ctx, c.failover, true, 0)
+		failover = true
+	}
+	if err != nil {
+		// only successful dials count
+		c.giveBackDial()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	atomic.AddInt64(&c.created, 1)
+	if failover {
+		atomic.AddInt64(&c.failoverCreated, 1)
+	}
+	c.emit(EventCreated)
+	e := &rconnEntry{
+		rconn:     rconn,
+		pool:      c,
+		gen:       gen,
+		createdAt: c.clock.Now(),
+		failover:  failover,
+		meta:      meta,
+		cleanup:   cleanup,
+	}
+	c.trackOpen(e, 1)
+	c.noteIdleTTL(rconn)
+	return e, nil
+}
+
+// sleep waits for d. It returns false if ctx is done or the pool
+// closed before.
+func (c *channelPool) sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := c.clock.NewTimer(d)
+	select {
+	case <-timer.C():
+		return true
+	case <-ctx.Done():
+	case <-c.done:
+	}
+	timer.Stop()
+	return false
+}
+
+// takeDial takes a dial from the WithMaxTotalDials() budget. It
+// returns false if the budget is exhausted.
+func (c *channelPool) takeDial() bool {
+	if c.maxTotalDials == 0 {
+		return true
+	}
+	for {
+		n := atomic.LoadInt64(&c.totalDials)
+		if n >= c.maxTotalDials {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&c.totalDials, n, n+1) {
+			return true
+		}
+	}
+}
+
+// giveBackDial gives back a dial taken by takeDial() that failed.
+func (c *channelPool) giveBackDial() {
+	if c.maxTotalDials > 0 {
+		atomic.AddInt64(&c.totalDials, -1)
+	}
+}
+
+// dialBudgetExhausted returns true if the WithMaxTotalDials() budget
+// is exhausted.
+func (c *channelPool) dialBudgetExhausted() bool {
+	return c.maxTotalDials > 0 && atomic.LoadInt64(&c.totalDials) >= c.maxTotalDials
+}
+
+// create calls factory for attempt within the dial timeout if any,
+// then primes the new RPC-able connection, see WithPrime(). legacy is
+// true if factory ignores its context.
+func (c *channelPool) create(ctx context.Context, factory metaFactory, legacy bool, attempt int) (rconn RpcAble, meta map[string]string, cleanup func(), err error) {
+	if c.dialTimeout > 0 {
+		rconn, meta, cleanup, err = c.dialWithTimeout(ctx, factory, legacy, attempt)
+	} else {
+		rconn, meta, cleanup, err = c.callFactory(ctx, factory, attempt)
+	}
+	if err == nil && c.prime != nil {
+		if err = c.callPrime(ctx, rconn); err != nil {
+			c.closeRpcAble(rconn, cleanup)
+			rconn, meta, cleanup = nil, nil, nil
+		}
+	}
+
+	// the caller giving up is not a factory failure
+	if err == nil || ctx.Err() == nil {
+		c.recordDial(err != nil)
+	}
+	return
+}
+
+// recordDial updates the dial error rate with the outcome of a
+// factory call.
+func (c *channelPool) recordDial(failed bool) {
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	for {
+		old := atomic.LoadUint64(&c.dialErrorRate)
+		next := math.Float64frombits(old)
+		next += dialErrorWeight * (sample - next)
+		if atomic.CompareAndSwapUint64(&c.dialErrorRate, old, math.Float64bits(next)) {
+			return
+		}
+	}
+}
+
+// dialWithTimeout calls factory, giving up after the dial timeout
+// with ErrDialTimeout. A context aware factory is cancelled, while a
+// legacy one is abandoned, its late RPC-able connection being closed.
+func (c *channelPool) dialWithTimeout(ctx context.Context, factory metaFactory, legacy bool, attempt int) (RpcAble, map[string]string, func(), error) {
+	dialCtx, cancel := context.WithTimeout(ctx, c.dialTimeout)
+	defer cancel()
+
+	if !legacy {
+		rconn, meta, cleanup, err := c.callFactory(dialCtx, factory, attempt)
+		if err != nil && ctx.Err() == nil && dialCtx.Err() == context.DeadlineExceeded {
+			return nil, nil, nil, ErrDialTimeout
+		}
+		return rconn, meta, cleanup, err
+	}
+
+	type result struct {
+		rconn   RpcAble
+		meta    map[string]string
+		cleanup func()
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rconn, meta, cleanup, err := c.callFactory(dialCtx, factory, attempt)
+		done <- result{rconn: rconn, meta: meta, cleanup: cleanup, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.rconn, res.meta, res.cleanup, res.err
+	case <-dialCtx.Done():
+		go func() {
+			if res := <-done; res.err == nil {
+				c.closeRpcAble(res.rconn, res.cleanup)
+			}
+		}()
+		if err := ctx.Err(); err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, ErrDialTimeout
+	}
+}
+
+// callPrime calls the WithPrime() function against rconn. A panic in
+// it is recovered and returned as an error.
+func (c *channelPool) callPrime(ctx context.Context, rconn RpcAble) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Printf("pool: prime func panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("prime func panicked: %v", r)
+		}
+	}()
+	if err = c.prime(ctx, rconn); err != nil {
+		err = fmt.Errorf("prime failed: %w", err)
+	}
+	return
+}
+
+// callFactory calls factory for attempt, then decorates the new
+// RPC-able connection, see WithConnDecorator(). A panic in factory or
+// in the decorator is recovered and returned as an error, the RPC-able
+// connection being closed in the latter case.
+func (c *channelPool) callFactory(ctx context.Context, factory metaFactory, attempt int) (rconn RpcAble, meta map[string]string, cleanup func(), err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Printf("pool: factory panicked: %v\n%s", r, debug.Stack())
+			if rconn != nil {
+				// the decorator panicked, rconn is not decorated
+				c.closeRpcAble(rconn, cleanup)
+			}
+			rconn, meta, cleanup, err = nil, nil, nil, fmt.Errorf("factory panicked: %v", r)
+		}
+	}()
+	rconn, meta, cleanup, err = factory(ctx, attempt)
+	if err == nil && c.decorator != nil {
+		rconn = c.decorator(rconn)
+	}
+	return
+}
@@ -0,0 +1,413 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPool_DialTimeout(t *testing.T) {
+	late := make(chan *stubRconn, 1)
+	p, err := NewChannelPool(0, MaximumCap, func() (RpcAble, error) {
+		time.Sleep(100 * time.Millisecond)
+		rconn := &stubRconn{}
+		late <- rconn
+		return rconn, nil
+	}, WithDialTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	start := time.Now()
+	if _, err := p.Get(); err != ErrDialTimeout {
+		t.Errorf("Get error. Expecting ErrDialTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Get error. Dial timeout did not fire in time: %s", elapsed)
+	}
+
+	// the late rconn is closed
+	rconn := <-late
+	deadline := time.Now().Add(time.Second)
+	for !rconn.isClosed() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !rconn.isClosed() {
+		t.Errorf("DialTimeout error. Late rconn should be closed")
+	}
+}
+
+func TestPool_DialTimeoutContext(t *testing.T) {
+	p, err := NewChannelPoolContext(0, MaximumCap, func(ctx context.Context) (RpcAble, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithDialTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if _, err := p.Get(); err != ErrDialTimeout {
+		t.Errorf("Get error. Expecting ErrDialTimeout, got %v", err)
+	}
+
+	// the caller context expires first
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("GetContext error. Expecting context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestPool_FailoverFactory(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, func() (RpcAble, error) {
+		return nil, errors.New("primary down")
+	}, WithFailoverFactory(newStubFactory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	rconn.Close()
+
+	stats := p.Stats()
+	if stats.Created != 1 || stats.FailoverCreated != 1 {
+		t.Errorf("FailoverFactory error. Expecting %d created by failover, got %d/%d",
+			1, stats.FailoverCreated, stats.Created)
+	}
+	if infos := p.Inspect(); len(infos) != 1 || !infos[0].Failover {
+		t.Errorf("FailoverFactory error. Expecting the pooled rconn to be tagged")
+	}
+
+	// the failover is subject to the dial timeout
+	p, err = NewChannelPool(0, MaximumCap, func() (RpcAble, error) {
+		return nil, errors.New("primary down")
+	}, WithFailoverFactory(func() (RpcAble, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &stubRconn{}, nil
+	}), WithDialTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if _, err := p.Get(); err != ErrDialTimeout {
+		t.Errorf("Get error. Expecting ErrDialTimeout, got %v", err)
+	}
+}
+
+func TestPool_DialAttempts(t *testing.T) {
+	backends := []string{"primary", "secondary", "tertiary"}
+	var attempts []int
+	p, err := NewChannelPoolAttempt(0, MaximumCap, func(_ context.Context, attempt int) (RpcAble, error) {
+		attempts = append(attempts, attempt)
+		if backends[attempt%len(backends)] != "tertiary" {
+			return nil, errors.New(backends[attempt%len(backends)] + " down")
+		}
+		return &stubRconn{id: attempt}, nil
+	}, WithDialAttempts(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	defer rconn.Close()
+	if len(attempts) != 3 || attempts[0] != 0 || attempts[1] != 1 || attempts[2] != 2 {
+		t.Errorf("DialAttempts error. Expecting attempts [0 1 2], got %v", attempts)
+	}
+	if id := rconn.(*PoolRconn).RpcAble.(*stubRconn).id; id != 2 {
+		t.Errorf("DialAttempts error. Expecting rconn from attempt %d, got %d", 2, id)
+	}
+
+	// attempts are bounded, the last error being returned
+	attempts = nil
+	p2, _ := NewChannelPoolAttempt(0, MaximumCap, func(_ context.Context, attempt int) (RpcAble, error) {
+		attempts = append(attempts, attempt)
+		return nil, errors.New("down")
+	}, WithDialAttempts(2))
+	defer p2.Close()
+	if _, err := p2.Get(); err == nil || err.Error() != "down" {
+		t.Errorf("Get error. Expecting down, got %v", err)
+	}
+	if len(attempts) != 2 {
+		t.Errorf("DialAttempts error. Expecting %d attempts, got %v", 2, attempts)
+	}
+}
+
+func TestPool_MaxTotalDials(t *testing.T) {
+	fail := false
+	factory := newStubFactory()
+	p, err := NewChannelPool(0, MaximumCap, func() (RpcAble, error) {
+		if fail {
+			return nil, errors.New("down")
+		}
+		return factory()
+	}, WithMaxTotalDials(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// failed dials are not counted
+	fail = true
+	if _, err := p.Get(); err == nil || err.Error() != "down" {
+		t.Errorf("Get error. Expecting down, got %v", err)
+	}
+	fail = false
+
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+
+	// the third distinct dial is refused, Get() waiting for a reused one
+	got := make(chan Conn, 1)
+	go func() {
+		rconn, err := p.Get()
+		if err != nil {
+			t.Errorf("Get error: %s", err)
+		}
+		got <- rconn
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if len(got) != 0 {
+		t.Fatal("MaxTotalDials error. Expecting Get() to wait")
+	}
+	stub1 := rconn1.(*PoolRconn).RpcAble
+	rconn1.Close()
+	select {
+	case rconn := <-got:
+		if rconn.(*PoolRconn).RpcAble != stub1 {
+			t.Errorf("MaxTotalDials error. Expecting the returned rconn")
+		}
+		rconn.MarkUnusable()
+		rconn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("MaxTotalDials error. Get() still waiting")
+	}
+
+	// closing rconns doesn't give the budget back
+	rconn2.MarkUnusable()
+	rconn2.Close()
+	if _, err := p.Get(); err != ErrDialBudgetExhausted {
+		t.Errorf("Get error. Expecting %v, got %v", ErrDialBudgetExhausted, err)
+	}
+	if stats := p.Stats(); stats.Created != 2 {
+		t.Errorf("MaxTotalDials error. Expecting %d created, got %d", 2, stats.Created)
+	}
+	if err := p.Grow(1); err == nil {
+		t.Errorf("Grow error. Expecting an error once the budget is exhausted")
+	}
+}
+
+func TestPool_GetContextCancelVsTimeout(t *testing.T) {
+	errDial := errors.New("dial tcp: i/o timeout")
+	p, err := NewChannelPoolContext(0, MaximumCap, func(ctx context.Context) (RpcAble, error) {
+		<-ctx.Done()
+		// as net.Dialer, the factory returns its own error
+		return nil, errDial
+	}, WithDialTimeout(30*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// pool internal timeout
+	if _, err := p.GetContext(context.Background()); err != ErrDialTimeout {
+		t.Errorf("GetContext error. Expecting %v, got %v", ErrDialTimeout, err)
+	}
+
+	// caller cancellation while dialing
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("GetContext error. Expecting %v, got %v", context.Canceled, err)
+	}
+
+	// caller cancellation while waiting for an open slot
+	p.SetMaxOpenConns(1)
+	p.(*channelPool).reserve()
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("GetContext error. Expecting %v, got %v", context.Canceled, err)
+	}
+	p.(*channelPool).release()
+}
+
+func TestPool_DialErrorRate(t *testing.T) {
+	fail := true
+	factory := newStubFactory()
+	p, err := NewChannelPool(0, MaximumCap, func() (RpcAble, error) {
+		if fail {
+			return nil, errors.New("dial failed")
+		}
+		return factory()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if rate := p.Stats().DialErrorRate; rate != 0 {
+		t.Errorf("DialErrorRate error. Expecting 0, got %f", rate)
+	}
+
+	expected := 0.0
+	check := func(n int, sample float64) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if rconn, err := p.Get(); err == nil {
+				rconn.MarkUnusable()
+				rconn.Close()
+			}
+			expected += dialErrorWeight * (sample - expected)
+		}
+		if rate := p.Stats().DialErrorRate; math.Abs(rate-expected) > 1e-9 {
+			t.Errorf("DialErrorRate error. Expecting %f, got %f", expected, rate)
+		}
+	}
+
+	check(10, 1) // ~0.65
+	fail = false
+	check(5, 0) // ~0.38
+	fail = true
+	check(1, 1) // ~0.45
+}
+
+func TestPool_Prime(t *testing.T) {
+	var primed []*stubRconn
+	primeErr := errors.New("auth failed")
+	prime := func(ctx context.Context, rconn RpcAble) error {
+		stub := rconn.(*stubRconn)
+		primed = append(primed, stub)
+		if stub.id == 1 {
+			return primeErr
+		}
+		return nil
+	}
+
+	p, _ := NewChannelPool(0, 2, newStubFactory(),
+		WithPrime(prime), WithDialAttempts(2))
+	defer p.Close()
+
+	rconn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	if stub.id != 2 || len(primed) != 2 {
+		t.Fatalf("Prime error. Expecting the second rconn primed, got #%d, %d primes", stub.id, len(primed))
+	}
+	if !primed[0].isClosed() {
+		t.Error("Prime error. Expecting the unprimed rconn to be closed")
+	}
+	if rate := p.Stats().DialErrorRate; rate == 0 {
+		t.Error("Prime error. Expecting the priming failure to count as a dial failure")
+	}
+
+	// idle rconns are not primed again by default
+	rconn.Close()
+	rconn, _ = p.Get()
+	rconn.Close()
+	if len(primed) != 2 {
+		t.Errorf("Prime error. Expecting %d primes, got %d", 2, len(primed))
+	}
+
+	// unless asked to
+	primes := 0
+	p2, _ := NewChannelPool(1, 1, newStubFactory(),
+		WithPrime(func(ctx context.Context, rconn RpcAble) error {
+			primes++
+			return nil
+		}),
+		WithRePrime(true))
+	defer p2.Close()
+	rconn, _ = p2.Get()
+	rconn.Close()
+	if primes != 2 {
+		t.Errorf("RePrime error. Expecting %d primes, got %d", 2, primes)
+	}
+
+	// prime failure with no attempt left
+	p3, _ := NewChannelPool(0, 1, newStubFactory(), WithPrime(prime))
+	defer p3.Close()
+	if _, err := p3.Get(); !errors.Is(err, primeErr) {
+		t.Errorf("Prime error. Expecting %v, got %v", primeErr, err)
+	}
+}
+
+// countingRconn is a decorator counting the Call() calls of the
+// decorated RpcAble.
+type countingRconn struct {
+	RpcAble
+	calls int
+}
+
+func (c *countingRconn) Call(serviceMethod string, args, reply interface{}) error {
+	c.calls++
+	return c.RpcAble.Call(serviceMethod, args, reply)
+}
+
+func TestPool_ConnDecorator(t *testing.T) {
+	var decorated []*countingRconn
+	p, _ := NewChannelPool(1, 2, newStubFactory(),
+		WithConnDecorator(func(rconn RpcAble) RpcAble {
+			d := &countingRconn{RpcAble: rconn}
+			decorated = append(decorated, d)
+			return d
+		}))
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		rconn, _ := p.Get()
+		if err := rconn.Call("Svc.Method", nil, nil); err != nil {
+			t.Fatalf("Call error: %s", err)
+		}
+		rconn.Close()
+	}
+
+	if len(decorated) != 1 {
+		t.Fatalf("ConnDecorator error. Expecting %d decoration, got %d", 1, len(decorated))
+	}
+	if decorated[0].calls != 3 {
+		t.Errorf("ConnDecorator error. Expecting %d calls, got %d", 3, decorated[0].calls)
+	}
+	stub := decorated[0].RpcAble.(*stubRconn)
+	if stub.callCount() != 3 {
+		t.Errorf("ConnDecorator error. Expecting %d calls, got %d", 3, stub.callCount())
+	}
+
+	// closing the pool closes the underlying rconn through the decorator
+	p.Close()
+	if !stub.isClosed() {
+		t.Error("ConnDecorator error. Expecting the rconn to be closed")
+	}
+
+	// a panicking decorator doesn't leak the rconn
+	var raw *stubRconn
+	factory := newStubFactory()
+	p, _ = NewChannelPool(0, 2, func() (RpcAble, error) {
+		rconn, err := factory()
+		raw = rconn.(*stubRconn)
+		return rconn, err
+	}, WithLogger(&testLogger{}), WithConnDecorator(func(RpcAble) RpcAble {
+		panic("boom")
+	}))
+	defer p.Close()
+	if _, err := p.Get(); err == nil {
+		t.Error("ConnDecorator error. Expecting an error")
+	}
+	if raw == nil || !raw.isClosed() {
+		t.Error("ConnDecorator error. Expecting the undecorated rconn to be closed")
+	}
+}
@@ -0,0 +1,109 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// eventsBufferSize is the size of the channel returned by
+// Pool.Events().
+const eventsBufferSize = 128
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventCreated is emitted when an RPC-able connection is created
+	// by the factory or adopted via Pool.Put().
+	EventCreated EventKind = iota
+	// EventCheckedOut is emitted when an RPC-able connection is handed
+	// out by the pool.
+	EventCheckedOut
+	// EventReturned is emitted when an RPC-able connection is given
+	// back to the pool by closing it.
+	EventReturned
+	// EventClosed is emitted each time the pool closes an RPC-able
+	// connection, whatever the reason.
+	EventClosed
+	// EventDiscarded is emitted, before EventClosed, when an RPC-able
+	// connection is dropped because it is unusable, invalid or
+	// outdated.
+	EventDiscarded
+	// EventReaped is emitted, before EventClosed, when an idle
+	// RPC-able connection is dropped by a background health check.
+	EventReaped
+)
+
+var eventKindNames = [...]string{
+	EventCreated:    "created",
+	EventCheckedOut: "checked-out",
+	EventReturned:   "returned",
+	EventClosed:     "closed",
+	EventDiscarded:  "discarded",
+	EventReaped:     "reaped",
+}
+
+// String implements the fmt.Stringer interface.
+func (k EventKind) String() string {
+	if k >= 0 && int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "unknown"
+}
+
+// Event describes something that happened in a pool.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+	// Label is the Pool.GetLabeled() label of the checkout, for
+	// EventCheckedOut and EventReturned, empty otherwise.
+	Label string
+}
+
+// Events implements the Pool interfaces Events() method.
+func (c *channelPool) Events() <-chan Event {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	if c.events == nil {
+		c.events = make(chan Event, eventsBufferSize)
+		if c.eventsClosed {
+			close(c.events)
+		}
+	}
+	return c.events
+}
+
+// emit sends an event of kind kind to the Events() channel, if
+// any. The event is dropped if the channel is full.
+func (c *channelPool) emit(kind EventKind) {
+	c.emitLabel(kind, "")
+}
+
+// emitLabel is like emit() but for an event related to a checkout
+// labeled by label.
+func (c *channelPool) emitLabel(kind EventKind, label string) {
+	c.eventsMu.RLock()
+	defer c.eventsMu.RUnlock()
+
+	if c.events == nil || c.eventsClosed {
+		return
+	}
+
+	select {
+	case c.events <- Event{Kind: kind, Time: c.clock.Now(), Label: label}:
+	default:
+		atomic.AddInt64(&c.droppedEvents, 1)
+	}
+}
+
+// closeEvents closes the Events() channel.
+func (c *channelPool) closeEvents() {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	if c.events != nil && !c.eventsClosed {
+		close(c.events)
+	}
+	c.eventsClosed = true
+}
@@ -0,0 +1,96 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPool_Events(t *testing.T) {
+	p, err := NewChannelPool(0, 1, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := p.Events()
+
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+	rconn1.Close()
+	rconn2.Close() // pool is full
+	p.Close()
+
+	expected := []EventKind{
+		EventCreated, EventCheckedOut,
+		EventCreated, EventCheckedOut,
+		EventReturned,
+		EventReturned, EventClosed,
+		EventClosed,
+	}
+
+	var got []EventKind
+	for event := range events {
+		if event.Time.IsZero() || time.Since(event.Time) > time.Minute {
+			t.Errorf("Events error. Bad time for %s event: %s", event.Kind, event.Time)
+		}
+		got = append(got, event.Kind)
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("Events error. Expecting %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Events error. Expecting %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestPool_GetLabeled(t *testing.T) {
+	var labels []string
+	p, _ := NewChannelPool(1, 1, newStubFactory(),
+		WithOnGet(func(rconn Conn, label string) {
+			labels = append(labels, label)
+		}))
+	events := p.Events()
+
+	rconn, err := p.GetLabeled(context.Background(), "/users")
+	if err != nil {
+		t.Fatalf("GetLabeled error: %s", err)
+	}
+	rconn.Close()
+	rconn, _ = p.Get()
+	rconn.Close()
+	p.Close()
+
+	if len(labels) != 2 || labels[0] != "/users" || labels[1] != "" {
+		t.Errorf("OnGet error. Expecting [/users ], got %q", labels)
+	}
+
+	var got []string
+	for event := range events {
+		if event.Kind == EventCheckedOut || event.Kind == EventReturned {
+			got = append(got, event.Kind.String()+":"+event.Label)
+		}
+	}
+	expected := "[checked-out:/users returned:/users checked-out: returned:]"
+	if s := fmt.Sprint(got); s != expected {
+		t.Errorf("Events error. Expecting %s, got %s", expected, s)
+	}
+}
+
+func TestPool_EventsDropped(t *testing.T) {
+	p, _ := NewChannelPool(0, 1, newStubFactory())
+	defer p.Close()
+
+	p.Events()
+	for i := 0; i < eventsBufferSize; i++ {
+		rconn, _ := p.Get()
+		rconn.Close()
+	}
+
+	if stats := p.Stats(); stats.DroppedEvents == 0 {
+		t.Errorf("Events error. Some events should have been dropped")
+	}
+}
@@ -0,0 +1,72 @@
+package pool
+
+import (
+	"context"
+)
+
+// HealthReport is the outcome of Pool.HealthCheck().
+type HealthReport struct {
+	// Checked is the number of idle RPC-able connections pinged.
+	Checked int
+	// Healthy is the number of RPC-able connections whose ping
+	// succeeded.
+	Healthy int
+	// Unhealthy is the number of RPC-able connections whose ping
+	// failed or did not complete in time.
+	Unhealthy int
+	// FirstErr is the first ping error encountered, or the context
+	// error if some pings did not complete in time, nil if all
+	// RPC-able connections are healthy.
+	FirstErr error
+}
+
+// unhealthy records n unhealthy RPC-able connections failing with err.
+func (r *HealthReport) unhealthy(n int, err error) {
+	r.Unhealthy += n
+	if r.FirstErr == nil {
+		r.FirstErr = err
+	}
+}
+
+// HealthCheck implements the Pool interfaces HealthCheck() method.
+func (c *channelPool) HealthCheck(ctx context.Context, ping func(RpcAble) error) HealthReport {
+	idle := c.takeIdle(c.Len())
+
+	type result struct {
+		e   *rconnEntry
+		err error
+	}
+	results := make(chan result, len(idle))
+	for _, e := range idle {
+		go func(e *rconnEntry) {
+			results <- result{e: e, err: c.validate(ping, e.rconn)}
+		}(e)
+	}
+
+	report := HealthReport{Checked: len(idle)}
+	for pending := len(idle); pending > 0; pending-- {
+		select {
+		case res := <-results:
+			if res.err == nil {
+				report.Healthy++
+				c.put(res.e)
+				continue
+			}
+			report.unhealthy(1, res.err)
+			c.emit(EventDiscarded)
+			c.retire(res.e)
+
+		case <-ctx.Done():
+			report.unhealthy(pending, ctx.Err())
+			go func(pending int) {
+				for ; pending > 0; pending-- {
+					res := <-results
+					c.emit(EventDiscarded)
+					c.retire(res.e)
+				}
+			}(pending)
+			return report
+		}
+	}
+	return report
+}
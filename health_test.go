@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPool_HealthCheck(t *testing.T) {
+	p, _ := NewChannelPool(0, MaximumCap, newStubFactory())
+	defer p.Close()
+
+	errDead := errors.New("dead")
+	stubs := []*stubRconn{{id: 1}, {id: 2, callErr: errDead}, {id: 3}, {id: 4, callErr: errDead}, {id: 5}}
+	for _, stub := range stubs {
+		p.Put(stub)
+	}
+
+	// a checked-out rconn is not checked
+	busy, _ := p.Get()
+	defer busy.Close()
+
+	ping := func(rconn RpcAble) error {
+		return rconn.Call("Health.Ping", nil, nil)
+	}
+	report := p.HealthCheck(context.Background(), ping)
+	expected := HealthReport{Checked: 4, Healthy: 2, Unhealthy: 2, FirstErr: errDead}
+	if report != expected {
+		t.Errorf("HealthCheck error. Expecting %+v, got %+v", expected, report)
+	}
+	if stubs[0].callCount() != 0 {
+		t.Errorf("HealthCheck error. Checked-out rconn should not be pinged")
+	}
+	for _, stub := range stubs[1:] {
+		if closed := stub.isClosed(); closed != (stub.callErr != nil) {
+			t.Errorf("HealthCheck error. Rconn #%d closed: %t", stub.id, closed)
+		}
+	}
+	if p.Len() != 2 {
+		t.Errorf("HealthCheck error. Expecting %d idle, got %d", 2, p.Len())
+	}
+
+	// pings not completed in time are unhealthy
+	unblock := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report = p.HealthCheck(ctx, func(rconn RpcAble) error {
+		if rconn.(*stubRconn).id == 3 {
+			<-unblock
+		}
+		return nil
+	})
+	expected = HealthReport{Checked: 2, Healthy: 1, Unhealthy: 1, FirstErr: context.DeadlineExceeded}
+	if report != expected {
+		t.Errorf("HealthCheck error. Expecting %+v, got %+v", expected, report)
+	}
+	close(unblock)
+	deadline := time.Now().Add(time.Second)
+	for !stubs[2].isClosed() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !stubs[2].isClosed() {
+		t.Errorf("HealthCheck error. Expecting late rconn to be closed")
+	}
+}
@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConnInfo is a read-only snapshot of the metadata of an idle
+// RPC-able connection, as returned by Pool.Inspect().
+type ConnInfo struct {
+	// Age is the time elapsed since the RPC-able connection was created.
+	Age time.Duration
+	// LastUsed is the last time the RPC-able connection was returned
+	// to the pool, or its creation time if it never was.
+	LastUsed time.Time
+	// Uses is the number of times the RPC-able connection has been
+	// checked out from the pool.
+	Uses int
+	// AvgLatency is the exponentially-weighted moving average of the
+	// Call() durations on the RPC-able connection, or 0 if no call has
+	// been made yet.
+	AvgLatency time.Duration
+	// Failover is true if the RPC-able connection has been created by
+	// the WithFailoverFactory() factory.
+	Failover bool
+	// LastError is the last error returned by Call() on the RPC-able
+	// connection, or nil.
+	LastError error
+}
+
+// Inspect implements the Pool interfaces Inspect() method.
+func (c *channelPool) Inspect() []ConnInfo {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var infos []ConnInfo
+	c.rotate(func(e *rconnEntry) bool {
+		infos = append(infos, ConnInfo{
+			Age:        now.Sub(e.createdAt),
+			LastUsed:   e.idleSince,
+			Uses:       e.uses,
+			AvgLatency: time.Duration(atomic.LoadInt64(&e.avgLatency)),
+			Failover:   e.failover,
+			LastError:  e.lastError(),
+		})
+		return true
+	})
+	return infos
+}
@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPool_Inspect(t *testing.T) {
+	p, err := NewChannelPool(InitialCap, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	rconn, _ := p.Get()
+	rconn.Close()
+
+	infos := p.Inspect()
+	if len(infos) != InitialCap {
+		t.Fatalf("Inspect error. Expecting %d entries, got %d", InitialCap, len(infos))
+	}
+	if p.Len() != InitialCap {
+		t.Errorf("Inspect error. Expecting %d idle, got %d", InitialCap, p.Len())
+	}
+
+	for i, info := range infos {
+		if info.Age < 10*time.Millisecond || info.Age > time.Minute {
+			t.Errorf("Inspect error. Unexpected age %s for entry #%d", info.Age, i)
+		}
+	}
+
+	// the checked out rconn is now the last one
+	last := infos[len(infos)-1]
+	if last.Uses != 1 {
+		t.Errorf("Inspect error. Expecting %d uses, got %d", 1, last.Uses)
+	}
+	if !last.LastUsed.After(infos[0].LastUsed) {
+		t.Errorf("Inspect error. Returned rconn should be the last used")
+	}
+
+	p.Close()
+	if infos := p.Inspect(); len(infos) != 0 {
+		t.Errorf("Inspect error. Expecting no entry once closed, got %d", len(infos))
+	}
+}
@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencySkim is the maximum number of idle rconns compared by a
+// latency aware pool to select the one to hand out.
+const latencySkim = 4
+
+// latencyWeight is the weight of the newest sample in the latency
+// exponentially-weighted moving averages.
+const latencyWeight = 0.2
+
+// updateEWMA updates atomically the exponentially-weighted moving
+// average avg, expressed in nanoseconds, with sample. A zero avg
+// means no sample yet.
+func updateEWMA(avg *int64, sample time.Duration) {
+	for {
+		old := atomic.LoadInt64(avg)
+		next := int64(sample)
+		if old != 0 {
+			next = old + int64(latencyWeight*float64(next-old))
+		}
+		if atomic.CompareAndSwapInt64(avg, old, next) {
+			return
+		}
+	}
+}
+
+// recordLatency records the duration of a call made on the rconn of e.
+func (c *channelPool) recordLatency(e *rconnEntry, d time.Duration) {
+	updateEWMA(&e.avgLatency, d)
+	updateEWMA(&c.avgLatency, d)
+}
+
+// takeFastest removes from the pool and returns the rconn having the
+// lowest average latency among the next latencySkim idle ones. An
+// rconn without latency data yet is considered the fastest, so
+// without any data, rconns are handed out in FIFO order. The order of
+// the other idle rconns is kept. It returns nil if there is no idle
+// rconn, and ErrClosed if the pool is closed.
+func (c *channelPool) takeFastest() (*rconnEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rconns == nil {
+		return nil, ErrClosed
+	}
+
+	var (
+		best    *rconnEntry
+		skimmed int
+	)
+	c.rotate(func(e *rconnEntry) bool {
+		if skimmed < latencySkim {
+			skimmed++
+			if best == nil ||
+				atomic.LoadInt64(&e.avgLatency) < atomic.LoadInt64(&best.avgLatency) {
+				best = e
+			}
+		}
+		return true
+	})
+	if best == nil {
+		return nil, nil
+	}
+
+	if taken := c.rotate(func(e *rconnEntry) bool { return e != best }); len(taken) == 0 {
+		// taken in the meantime by a concurrent unlocked receive
+		return nil, nil
+	}
+	return best, nil
+}
@@ -0,0 +1,118 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateEWMA(t *testing.T) {
+	var avg int64
+
+	updateEWMA(&avg, 100)
+	if avg != 100 {
+		t.Errorf("EWMA error. Expecting %d, got %d", 100, avg)
+	}
+
+	updateEWMA(&avg, 200)
+	if avg != 120 {
+		t.Errorf("EWMA error. Expecting %d, got %d", 120, avg)
+	}
+}
+
+func TestRconn_AvgLatency(t *testing.T) {
+	p, err := NewChannelPool(0, 1, func() (RpcAble, error) {
+		return &sleepyRconn{delay: 20 * time.Millisecond}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	if rconn.AvgLatency() != 0 {
+		t.Errorf("AvgLatency error. Expecting 0 before any call, got %s", rconn.AvgLatency())
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := rconn.Call("Arith.Mul", nil, nil); err != nil {
+			t.Fatalf("Call error: %s", err)
+		}
+	}
+	rconn.Close()
+
+	// latency travels with the underlying rconn
+	rconn, _ = p.Get()
+	defer rconn.Close()
+	if avg := rconn.AvgLatency(); avg < 20*time.Millisecond || avg > 200*time.Millisecond {
+		t.Errorf("AvgLatency error. Unexpected average %s", avg)
+	}
+	if avg := p.Stats().AvgLatency; avg < 20*time.Millisecond || avg > 200*time.Millisecond {
+		t.Errorf("Stats error. Unexpected average latency %s", avg)
+	}
+}
+
+func TestPool_LatencyAware(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory(), WithLatencyAware(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	slow := &sleepyRconn{delay: 20 * time.Millisecond}
+	fast := &sleepyRconn{delay: time.Millisecond}
+	p.Put(slow)
+	p.Put(fast)
+
+	// without latency data, FIFO order
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+	if rconn1.(*PoolRconn).RpcAble != slow || rconn2.(*PoolRconn).RpcAble != fast {
+		t.Fatalf("LatencyAware error. Expecting FIFO order without latency data")
+	}
+
+	rconn1.Call("Arith.Mul", nil, nil)
+	rconn2.Call("Arith.Mul", nil, nil)
+	rconn1.Close()
+	rconn2.Close()
+
+	rconn, _ := p.Get()
+	defer rconn.Close()
+	if rconn.(*PoolRconn).RpcAble != fast {
+		t.Errorf("LatencyAware error. Expecting the fastest rconn first")
+	}
+}
+
+func TestPool_LatencyAwareFIFO(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory(), WithLatencyAware(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	const n = 2*latencySkim + 1
+	for i := 1; i <= n; i++ {
+		p.Put(&stubRconn{id: i})
+	}
+
+	// without latency data, FIFO order, even beyond latencySkim rconns
+	for i := 1; i <= n; i++ {
+		rconn, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+		if id := rconn.(*PoolRconn).RpcAble.(*stubRconn).id; id != i {
+			t.Errorf("LatencyAware error. Expecting rconn #%d, got #%d", i, id)
+		}
+	}
+}
+
+// sleepyRconn is a stubRconn whose Call() takes delay.
+type sleepyRconn struct {
+	stubRconn
+	delay time.Duration
+}
+
+func (s *sleepyRconn) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	time.Sleep(s.delay)
+	return s.stubRconn.Call(serviceMethod, args, reply)
+}
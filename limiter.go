@@ -0,0 +1,78 @@
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Limiter caps the total number of RPC-able connections open across
+// the pools sharing it, for example to stay within a global file
+// descriptor budget. See WithSharedLimiter(). It is safe for
+// concurrent use.
+type Limiter struct {
+	max  int64
+	open int64 // accessed atomically
+
+	changedMu sync.Mutex
+	changed   chan struct{}
+}
+
+// NewLimiter returns a new Limiter allowing at most n RPC-able
+// connections open at once across the pools sharing it. n is
+// clamped to 1.
+func NewLimiter(n int) *Limiter {
+	if n < 1 {
+		n = 1
+	}
+	return &Limiter{max: int64(n)}
+}
+
+// Open returns the number of RPC-able connections currently open
+// across the pools sharing l.
+func (l *Limiter) Open() int {
+	return int(atomic.LoadInt64(&l.open))
+}
+
+// Max returns the maximum number of RPC-able connections open at
+// once across the pools sharing l.
+func (l *Limiter) Max() int {
+	return int(l.max)
+}
+
+// acquire takes a slot for a new RPC-able connection. It returns
+// false if the limit is reached.
+func (l *Limiter) acquire() bool {
+	for {
+		open := atomic.LoadInt64(&l.open)
+		if open >= l.max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&l.open, open, open+1) {
+			return true
+		}
+	}
+}
+
+// release releases a slot taken by acquire(), waking up the Get()
+// calls of all the pools sharing l waiting for it.
+func (l *Limiter) release() {
+	atomic.AddInt64(&l.open, -1)
+
+	l.changedMu.Lock()
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+	l.changedMu.Unlock()
+}
+
+// changes returns a channel closed on the next slot release.
+func (l *Limiter) changes() <-chan struct{} {
+	l.changedMu.Lock()
+	defer l.changedMu.Unlock()
+
+	if l.changed == nil {
+		l.changed = make(chan struct{})
+	}
+	return l.changed
+}
@@ -0,0 +1,96 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Shared(t *testing.T) {
+	var open, maxOpen int64
+	factory := newStubFactory()
+	countingFactory := func() (RpcAble, error) {
+		n := atomic.AddInt64(&open, 1)
+		for {
+			max := atomic.LoadInt64(&maxOpen)
+			if n <= max || atomic.CompareAndSwapInt64(&maxOpen, max, n) {
+				break
+			}
+		}
+		return factory()
+	}
+	closeFunc := WithCloseFunc(func(rconn RpcAble) error {
+		atomic.AddInt64(&open, -1)
+		return rconn.Close()
+	})
+
+	limiter := NewLimiter(3)
+	p1, _ := NewChannelPool(2, 5, countingFactory, WithSharedLimiter(limiter), closeFunc)
+	defer p1.Close()
+	// only 1 initial rconn fits
+	p2, _ := NewChannelPool(2, 5, countingFactory, WithSharedLimiter(limiter), closeFunc)
+	defer p2.Close()
+
+	if n := limiter.Open(); n != 3 {
+		t.Errorf("Limiter error. Expecting %d open, got %d", 3, n)
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range []Pool{p1, p2, p1, p2, p1, p2} {
+		wg.Add(1)
+		go func(p Pool) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				rconn, err := p.Get()
+				if err != nil {
+					t.Errorf("Get error: %s", err)
+					return
+				}
+				if i%5 == 0 {
+					// force new dials
+					rconn.MarkUnusable()
+				}
+				rconn.Close()
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if max := atomic.LoadInt64(&maxOpen); max > 3 {
+		t.Errorf("Limiter error. Expecting at most %d open, got %d", 3, max)
+	}
+	if n := p1.Stats().Open + p2.Stats().Open; n > 3 {
+		t.Errorf("Limiter error. Expecting at most %d open, got %d", 3, n)
+	}
+
+	// a slot released by a pool wakes up the Get() calls waiting in
+	// the other one
+	p1.Shrink(5)
+	p2.Shrink(5)
+	rconn1, _ := p1.Get()
+	rconn2, _ := p2.Get()
+	defer rconn2.Close()
+	rconn3, _ := p2.Get()
+	defer rconn3.Close()
+
+	// Put() cannot exceed the limit
+	rconn, _ := factory()
+	if err := p1.Put(rconn); err != ErrFull {
+		t.Errorf("Put error. Expecting %v, got %v", ErrFull, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		rconn1.MarkUnusable()
+		rconn1.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rconn4, err := p2.GetContext(ctx)
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	rconn4.Close()
+}
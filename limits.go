@@ -0,0 +1,332 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// minReapInterval is the minimum interval between two runs of the
+// reaper closing the idle RPC-able connections exceeding their
+// maximum lifetime or idle time.
+var minReapInterval = time.Millisecond
+
+// SetConnMaxLifetime implements the Pool interfaces
+// SetConnMaxLifetime() method.
+func (c *channelPool) SetConnMaxLifetime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.StoreInt64(&c.maxLifetime, int64(d))
+	c.startReaper(d)
+}
+
+// SetConnMaxIdleTime implements the Pool interfaces
+// SetConnMaxIdleTime() method.
+func (c *channelPool) SetConnMaxIdleTime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.StoreInt64(&c.maxIdleTime, int64(d))
+	c.startReaper(d)
+}
+
+// SetMaxIdleConns implements the Pool interfaces SetMaxIdleConns()
+// method.
+func (c *channelPool) SetMaxIdleConns(n int) {
+	if n < 0 {
+		n = 0
+	} else if n > c.maxCap {
+		n = c.maxCap
+	}
+
+	c.mu.Lock()
+	c.maxIdle = n
+
+	var excess []*rconnEntry
+	for c.rconns != nil && len(c.rconns) > n {
+		select {
+		case e := <-c.rconns:
+			atomic.AddInt64(&c.idle, -1)
+			excess = append(excess, e)
+		default:
+			// emptied in the meantime by concurrent Get() calls
+		}
+	}
+	c.mu.Unlock()
+
+	atomic.AddInt64(&c.maxIdleClosed, int64(len(excess)))
+	for _, e := range excess {
+		c.closeRconn(e)
+	}
+}
+
+// validatorFunc wraps the pool validator as atomic.Value cannot
+// store nil.
+type validatorFunc struct {
+	fn func(RpcAble) error
+}
+
+// SetValidator implements the Pool interfaces SetValidator() method.
+func (c *channelPool) SetValidator(validator func(RpcAble) error) {
+	c.validator.Store(validatorFunc{validator})
+}
+
+// getValidator returns the pool validator, nil if none.
+func (c *channelPool) getValidator() func(RpcAble) error {
+	v, _ := c.validator.Load().(validatorFunc)
+	return v.fn
+}
+
+// SetMaxOpenConns implements the Pool interfaces SetMaxOpenConns()
+// method.
+func (c *channelPool) SetMaxOpenConns(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&c.maxOpen, int64(n))
+
+	// a higher limit can unblock waiting Get() calls
+	c.notify()
+}
+
+// reserve reserves a slot for a new RPC-able connection. It returns
+// false if the maximum number of open RPC-able connections is
+// reached, for this pool or across the pools sharing its limiter.
+func (c *channelPool) reserve() bool {
+	return c.reserveOver(0)
+}
+
+// reserveOver is like reserve() but allows extra RPC-able connections
+// beyond the SetMaxOpenConns() limit, see WithOverflowAllowance().
+func (c *channelPool) reserveOver(extra int64) bool {
+	for {
+		open := atomic.LoadInt64(&c.numOpen)
+		if max := atomic.LoadInt64(&c.maxOpen); max > 0 && open >= max+extra {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&c.numOpen, open, open+1) {
+			break
+		}
+	}
+	if c.limiter != nil && !c.limiter.acquire() {
+		atomic.AddInt64(&c.numOpen, -1)
+		return false
+	}
+	return true
+}
+
+// release releases a slot reserved by reserve(), waking up the Get()
+// calls waiting for it.
+func (c *channelPool) release() {
+	n := atomic.AddInt64(&c.numOpen, -1)
+	if c.limiter != nil {
+		c.limiter.release()
+	}
+	c.notify()
+	if n == 0 {
+		c.checkDrained()
+	}
+}
+
+// checkDrained closes the Done() channel if the pool is closed and no
+// RPC-able connection is open anymore. As shutdown() marks the pool
+// closed before calling it, and release() calls it after the last
+// slot is released, whichever comes last closes the channel.
+func (c *channelPool) checkDrained() {
+	if c.IsClosed() && atomic.LoadInt64(&c.numOpen) == 0 {
+		c.drainedOnce.Do(func() { close(c.drained) })
+	}
+}
+
+// enqueue registers a Get() call about to wait for an open slot. It
+// returns false if WithMaxWaiters() calls are already waiting.
+func (c *channelPool) enqueue() bool {
+	for {
+		n := atomic.LoadInt64(&c.waiters)
+		if c.maxWaiters > 0 && n >= c.maxWaiters {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&c.waiters, n, n+1) {
+			return true
+		}
+	}
+}
+
+// overOpen returns true if more RPC-able connections than allowed by
+// SetMaxOpenConns() are open, not counting the ones dialed beyond it
+// by GetPriority(), which are closed as soon as returned anyway.
+func (c *channelPool) overOpen() bool {
+	max := atomic.LoadInt64(&c.maxOpen)
+	return max > 0 &&
+		atomic.LoadInt64(&c.numOpen)-atomic.LoadInt64(&c.numOverflow) > max
+}
+
+// overSoftCap returns true if more RPC-able connections than allowed
+// by WithSoftCap() are open.
+func (c *channelPool) overSoftCap() bool {
+	return c.softCap > 0 && atomic.LoadInt64(&c.numOpen) > c.softCap
+}
+
+// changes returns a channel closed on the next change that could
+// allow a waiting Get() call to succeed.
+func (c *channelPool) changes() <-chan struct{} {
+	c.changedMu.Lock()
+	defer c.changedMu.Unlock()
+
+	if c.changed == nil {
+		c.changed = make(chan struct{})
+	}
+	return c.changed
+}
+
+// notify wakes up the Get() calls waiting for a change.
+func (c *channelPool) notify() {
+	c.changedMu.Lock()
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+	c.changedMu.Unlock()
+}
+
+// expired returns true if the rconn of e exceeds its maximum
+// lifetime. Sticky rconns never expire.
+func (c *channelPool) expired(e *rconnEntry, now time.Time) bool {
+	max := time.Duration(atomic.LoadInt64(&c.maxLifetime))
+	return max > 0 && now.Sub(e.createdAt) >= max && !isSticky(e.rconn)
+}
+
+// preferFresh returns true if the rconn of e is older than the
+// WithPreferFreshAfter() age while fewer than maxCap RPC-able
+// connections are open, so a fresh one can be dialed instead.
+func (c *channelPool) preferFresh(e *rconnEntry, now time.Time) bool {
+	return c.preferFreshAfter > 0 &&
+		now.Sub(e.createdAt) >= c.preferFreshAfter &&
+		atomic.LoadInt64(&c.numOpen) < int64(c.maxCap)
+}
+
+// usedUp adds the time elapsed since the rconn of e was checked out
+// to its cumulative use time, and returns true if it now exceeds the
+// WithMaxCumulativeUseTime() limit.
+func (c *channelPool) usedUp(e *rconnEntry) bool {
+	if c.maxUseTime <= 0 {
+		return false
+	}
+	e.useTime += c.since(e.checkedOutAt)
+	return e.useTime > c.maxUseTime
+}
+
+// idleExpired returns true if the rconn of e has been idle longer
+// than its maximum idle time. Sticky rconns never expire.
+func (c *channelPool) idleExpired(e *rconnEntry, now time.Time) bool {
+	max := idleTTL(e.rconn)
+	if max == 0 {
+		max = time.Duration(atomic.LoadInt64(&c.maxIdleTime))
+	}
+	return max > 0 && now.Sub(e.idleSince) >= max && !isSticky(e.rconn)
+}
+
+// noteIdleTTL starts the reaper if rconn has its own maximum idle
+// time, shortening the reap interval if needed. c.mu must not be
+// held.
+func (c *channelPool) noteIdleTTL(rconn RpcAble) {
+	ttl := idleTTL(rconn)
+	if ttl == 0 {
+		return
+	}
+	for {
+		min := atomic.LoadInt64(&c.minIdleTTL)
+		if min != 0 && min <= int64(ttl) ||
+			atomic.CompareAndSwapInt64(&c.minIdleTTL, min, int64(ttl)) {
+			break
+		}
+	}
+	c.startReaper(ttl)
+}
+
+// startReaper starts the reaper goroutine the first time a maximum
+// lifetime or idle time d is set.
+func (c *channelPool) startReaper(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	start := !c.reaping && c.rconns != nil
+	c.reaping = true
+	c.mu.Unlock()
+
+	if start {
+		go c.reaper()
+	}
+}
+
+// reaper periodically closes the idle RPC-able connections exceeding
+// their maximum lifetime or idle time, until the pool is closed.
+func (c *channelPool) reaper() {
+	for {
+		timer := c.clock.NewTimer(c.jitter(c.reapInterval()))
+		select {
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-timer.C():
+			c.reap()
+		}
+	}
+}
+
+// reapInterval returns the interval until the next reap, which is
+// the shortest of the maximum lifetime and idle times, including the
+// IdleLimited ones.
+func (c *channelPool) reapInterval() time.Duration {
+	d := time.Duration(atomic.LoadInt64(&c.maxLifetime))
+	if idle := time.Duration(atomic.LoadInt64(&c.maxIdleTime)); idle > 0 && (d == 0 || idle < d) {
+		d = idle
+	}
+	if ttl := time.Duration(atomic.LoadInt64(&c.minIdleTTL)); ttl > 0 && (d == 0 || ttl < d) {
+		d = ttl
+	}
+	if d == 0 {
+		// both disabled in the meantime, check again later
+		d = time.Second
+	}
+	if d < minReapInterval {
+		d = minReapInterval
+	}
+	return d
+}
+
+// reap closes the idle RPC-able connections exceeding their maximum
+// lifetime or idle time. Rconns exceeding their idle time are kept if
+// needed to honor WithMinIdle(), so the reaper doesn't fight the min
+// idle maintainer. The relative order of the other idle rconns is
+// kept.
+func (c *channelPool) reap() {
+	if c.isPaused() {
+		return
+	}
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	left := len(c.rconns)
+	reaped := c.rotate(func(e *rconnEntry) bool {
+		switch {
+		case c.expired(e, now):
+			atomic.AddInt64(&c.maxLifetimeClosed, 1)
+			e.replace = true
+		case left > c.minIdle && c.idleExpired(e, now):
+			atomic.AddInt64(&c.idleTimeoutClosed, 1)
+		default:
+			return true
+		}
+		left--
+		return false
+	})
+	c.mu.Unlock()
+
+	for _, e := range reaped {
+		c.emit(EventReaped)
+		c.closeRconn(e)
+	}
+}
@@ -0,0 +1,877 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_SetMaxIdleConns(t *testing.T) {
+	p, err := NewChannelPool(5, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.SetMaxIdleConns(2)
+	if p.Len() != 2 {
+		t.Errorf("SetMaxIdleConns error. Expecting %d idle, got %d", 2, p.Len())
+	}
+	if closed := p.Stats().Closed; closed != 3 {
+		t.Errorf("SetMaxIdleConns error. Expecting %d closed, got %d", 3, closed)
+	}
+
+	// returned rconns beyond the limit are closed
+	var rconns []Conn
+	for i := 0; i < 4; i++ {
+		rconn, _ := p.Get()
+		rconns = append(rconns, rconn)
+	}
+	for _, rconn := range rconns {
+		rconn.Close()
+	}
+	if p.Len() != 2 {
+		t.Errorf("SetMaxIdleConns error. Expecting %d idle, got %d", 2, p.Len())
+	}
+
+	// no idle rconn retained
+	p.SetMaxIdleConns(0)
+	rconn, _ := p.Get()
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	rconn.Close()
+	if p.Len() != 0 || !stub.isClosed() {
+		t.Errorf("SetMaxIdleConns error. Expecting no idle rconn, got %d", p.Len())
+	}
+
+	// capped to the maximum capacity
+	p.SetMaxIdleConns(MaximumCap + 10)
+	if err := p.Grow(MaximumCap + 10); err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != MaximumCap {
+		t.Errorf("SetMaxIdleConns error. Expecting %d idle, got %d", MaximumCap, p.Len())
+	}
+}
+
+func TestPool_WithMaxIdle(t *testing.T) {
+	p, err := NewChannelPool(10, 30, newStubFactory(), WithMaxIdle(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// the initial capacity is bounded too
+	if p.Len() != 5 {
+		t.Errorf("WithMaxIdle error. Expecting %d idle, got %d", 5, p.Len())
+	}
+
+	// burst to fill
+	var rconns []Conn
+	for i := 0; i < 30; i++ {
+		rconn, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+		rconns = append(rconns, rconn)
+	}
+	for _, rconn := range rconns {
+		rconn.Close()
+	}
+
+	stats := p.Stats()
+	if stats.Idle != 5 || stats.Open != 5 {
+		t.Errorf("WithMaxIdle error. Expecting %d idle and open, got %+v", 5, stats)
+	}
+	if stats.MaxIdleClosed != 25 {
+		t.Errorf("WithMaxIdle error. Expecting %d closed, got %d", 25, stats.MaxIdleClosed)
+	}
+	if max := p.Config().MaxIdle; max != 5 {
+		t.Errorf("Config error. Expecting MaxIdle %d, got %d", 5, max)
+	}
+}
+
+func TestPool_SetMaxOpenConns(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.SetMaxOpenConns(2)
+
+	rconn1, _ := p.Get()
+	rconn2, _ := p.Get()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("SetMaxOpenConns error. Expecting %v, got %v", context.DeadlineExceeded, err)
+	}
+	if n := p.Stats().WaitCount; n != 3 {
+		t.Errorf("SetMaxOpenConns error. Expecting %d waits, got %d", 3, n)
+	}
+	if n := p.Available(); n != 0 {
+		t.Errorf("SetMaxOpenConns error. Expecting %d available, got %d", 0, n)
+	}
+
+	// a waiting Get() gets the returned rconn
+	stub1 := rconn1.(*PoolRconn).RpcAble
+	got := make(chan RpcAble)
+	go func() {
+		rconn, err := p.Get()
+		if err != nil {
+			got <- nil
+			return
+		}
+		got <- rconn.(*PoolRconn).RpcAble
+		rconn.Close()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	rconn1.Close()
+	select {
+	case rconn := <-got:
+		if rconn != stub1 {
+			t.Errorf("SetMaxOpenConns error. Expecting the returned rconn")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SetMaxOpenConns error. Get() still waiting")
+	}
+
+	// lowering the limit lets checked-out rconns drain
+	rconn1, _ = p.Get()
+	p.SetMaxOpenConns(1)
+	stub1 = rconn1.(*PoolRconn).RpcAble
+	rconn1.Close()
+	if !stub1.(*stubRconn).isClosed() {
+		t.Errorf("SetMaxOpenConns error. Expecting rconn to be closed")
+	}
+	if open := p.Stats().Open; open != 1 {
+		t.Errorf("SetMaxOpenConns error. Expecting %d open, got %d", 1, open)
+	}
+	rconn2.Close()
+	if p.Len() != 1 {
+		t.Errorf("SetMaxOpenConns error. Expecting %d idle, got %d", 1, p.Len())
+	}
+
+	// Close() wakes up waiting Get() calls
+	rconn1, _ = p.Get()
+	defer rconn1.Close()
+	errs := make(chan error)
+	go func() {
+		_, err := p.Get()
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Close()
+	select {
+	case err := <-errs:
+		if err != ErrClosed {
+			t.Errorf("SetMaxOpenConns error. Expecting %v, got %v", ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SetMaxOpenConns error. Get() still waiting after Close()")
+	}
+}
+
+func TestPool_CloseWakesWaiters(t *testing.T) {
+	limiter := NewLimiter(1)
+	saturated, _ := NewChannelPool(0, 2, newStubFactory(), WithSharedLimiter(limiter))
+	p, _ := NewChannelPool(0, 2, newStubFactory())
+	p.SetMaxOpenConns(1)
+
+	rconn1, _ := p.Get()
+	defer rconn1.Close()
+	rconn2, _ := saturated.Get()
+	defer rconn2.Close()
+
+	// waiting for an open slot or for the shared limiter
+	errs := make(chan error, 3)
+	for _, get := range []func() (Conn, error){
+		p.Get,
+		func() (Conn, error) { return p.GetContext(context.Background()) },
+		saturated.Get,
+	} {
+		go func(get func() (Conn, error)) {
+			_, err := get()
+			errs <- err
+		}(get)
+	}
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Fatalf("Get error. Expecting Get() to wait, got %v", err)
+	default:
+	}
+
+	p.Close()
+	saturated.Close()
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			if err != ErrClosed {
+				t.Errorf("Get error. Expecting %v, got %v", ErrClosed, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Close error. Get() still waiting")
+		}
+	}
+}
+
+func TestPool_SetConnMaxLifetime(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+
+	p.SetConnMaxLifetime(30 * time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+
+	// the idle one has been reaped
+	if p.Len() != 0 {
+		t.Errorf("SetConnMaxLifetime error. Expecting no idle rconn, got %d", p.Len())
+	}
+
+	// the checked-out one is closed when returned
+	rconn.Close()
+	if !stub.isClosed() || p.Len() != 0 {
+		t.Errorf("SetConnMaxLifetime error. Expecting expired rconn to be closed")
+	}
+
+	p.SetConnMaxLifetime(0)
+	rconn, _ = p.Get()
+	rconn.Close()
+	time.Sleep(60 * time.Millisecond)
+	if p.Len() != 1 {
+		t.Errorf("SetConnMaxLifetime error. Expecting %d idle, got %d", 1, p.Len())
+	}
+}
+
+func TestPool_SetConnMaxIdleTime(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.SetConnMaxIdleTime(30 * time.Millisecond)
+
+	// a checked-out rconn is not reaped, whatever its idle time
+	rconn, _ := p.Get()
+	time.Sleep(60 * time.Millisecond)
+	if p.Len() != 0 {
+		t.Errorf("SetConnMaxIdleTime error. Expecting no idle rconn, got %d", p.Len())
+	}
+	if closed := p.Stats().Closed; closed != 1 {
+		t.Errorf("SetConnMaxIdleTime error. Expecting %d closed, got %d", 1, closed)
+	}
+
+	// returning it resets its idle time
+	rconn.Close()
+	if p.Len() != 1 {
+		t.Errorf("SetConnMaxIdleTime error. Expecting %d idle, got %d", 1, p.Len())
+	}
+	time.Sleep(60 * time.Millisecond)
+	if p.Len() != 0 {
+		t.Errorf("SetConnMaxIdleTime error. Expecting no idle rconn, got %d", p.Len())
+	}
+}
+
+// stickyRconn is a stubRconn implementing Sticky.
+type stickyRconn struct {
+	stubRconn
+	sticky bool
+}
+
+func (s *stickyRconn) Sticky() bool {
+	return s.sticky
+}
+
+func TestPool_Sticky(t *testing.T) {
+	fc := newFakeClock()
+	n := 0
+	p, _ := NewChannelPool(4, 4, func() (RpcAble, error) {
+		n++
+		return &stickyRconn{stubRconn: stubRconn{id: n}, sticky: n%2 == 0}, nil
+	}, withClock(fc))
+	defer p.Close()
+	c := p.(*channelPool)
+
+	atomic.StoreInt64(&c.maxLifetime, int64(time.Hour))
+	atomic.StoreInt64(&c.maxIdleTime, int64(time.Minute))
+	fc.Advance(2 * time.Hour)
+	c.reap()
+
+	if p.Len() != 2 {
+		t.Fatalf("Sticky error. Expecting %d idle, got %d", 2, p.Len())
+	}
+	stats := p.Stats()
+	if stats.MaxLifetimeClosed != 2 {
+		t.Errorf("Sticky error. Expecting %d reaped, got %d", 2, stats.MaxLifetimeClosed)
+	}
+
+	// sticky rconns are handed out, whatever their age, and kept once
+	// returned
+	var rconns []Conn
+	for i := 0; i < 2; i++ {
+		rconn, _ := p.Get()
+		if !isSticky(rconn.(*PoolRconn).RpcAble) {
+			t.Errorf("Sticky error. Expecting a sticky rconn")
+		}
+		rconns = append(rconns, rconn)
+	}
+	for _, rconn := range rconns {
+		rconn.Close()
+	}
+	if stats := p.Stats(); stats.Idle != 2 || stats.Closed != 2 {
+		t.Errorf("Sticky error. Expecting %d idle and %d closed, got %+v", 2, 2, stats)
+	}
+}
+
+// idleLimitedRconn is a stubRconn implementing IdleLimited.
+type idleLimitedRconn struct {
+	stubRconn
+	ttl time.Duration
+}
+
+func (l *idleLimitedRconn) IdleTTL() time.Duration {
+	return l.ttl
+}
+
+func TestPool_IdleTTL(t *testing.T) {
+	fc := newFakeClock()
+	ttls := []time.Duration{time.Minute, 5 * time.Minute, 0}
+	n := 0
+	p, _ := NewChannelPool(3, 3, func() (RpcAble, error) {
+		n++
+		return &idleLimitedRconn{stubRconn: stubRconn{id: n}, ttl: ttls[n-1]}, nil
+	}, withClock(fc))
+	defer p.Close()
+	c := p.(*channelPool)
+
+	// the reaper runs even without pool-wide idle time
+	c.mu.Lock()
+	reaping := c.reaping
+	c.mu.Unlock()
+	if !reaping {
+		t.Error("IdleTTL error. Expecting the reaper to run")
+	}
+	if d := c.reapInterval(); d != time.Minute {
+		t.Errorf("IdleTTL error. Expecting a reap interval of %s, got %s", time.Minute, d)
+	}
+
+	ids := func() (ids []int) {
+		for _, e := range idleEntries(p) {
+			ids = append(ids, e.rconn.(*idleLimitedRconn).id)
+		}
+		return
+	}
+
+	fc.Advance(time.Minute)
+	c.reap()
+	if got := ids(); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("IdleTTL error. Expecting rconns [2 3] left, got %v", got)
+	}
+
+	fc.Advance(4 * time.Minute)
+	c.reap()
+	if got := ids(); len(got) != 1 || got[0] != 3 {
+		t.Errorf("IdleTTL error. Expecting rconn [3] left, got %v", got)
+	}
+
+	// the pool-wide idle time applies to others
+	atomic.StoreInt64(&c.maxIdleTime, int64(10*time.Minute))
+	fc.Advance(5 * time.Minute)
+	c.reap()
+	if p.Len() != 0 {
+		t.Errorf("IdleTTL error. Expecting no idle rconn, got %d", p.Len())
+	}
+	if stats := p.Stats(); stats.IdleTimeoutClosed != 3 {
+		t.Errorf("IdleTTL error. Expecting %d reaped, got %d", 3, stats.IdleTimeoutClosed)
+	}
+}
+
+func TestPool_StatsClosedByReason(t *testing.T) {
+	p, err := NewChannelPool(5, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// idle limit
+	p.SetMaxIdleConns(3)
+	rconn, _ := p.Get()
+	p.Put(&stubRconn{})
+	rconn.Close()
+	if n := p.Stats().MaxIdleClosed; n != 3 {
+		t.Errorf("MaxIdleClosed error. Expecting %d, got %d", 3, n)
+	}
+
+	// idle time reaper
+	p.SetConnMaxIdleTime(20 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if n := p.Stats().IdleTimeoutClosed; n != 3 {
+		t.Errorf("IdleTimeoutClosed error. Expecting %d, got %d", 3, n)
+	}
+	p.SetConnMaxIdleTime(0)
+
+	// lifetime
+	rconn, _ = p.Get()
+	p.SetConnMaxLifetime(20 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	rconn.Close()
+
+	stats := p.Stats()
+	if stats.MaxLifetimeClosed != 1 {
+		t.Errorf("MaxLifetimeClosed error. Expecting %d, got %d", 1, stats.MaxLifetimeClosed)
+	}
+	if stats.MaxIdleClosed != 3 || stats.IdleTimeoutClosed != 3 {
+		t.Errorf("Stats error. Unexpected closed counters %+v", stats)
+	}
+}
+
+func TestPool_SetConnMaxIdleTimeSweep(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory(),
+		WithHealthSweep(5*time.Millisecond, func(RpcAble) error { return nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	before := p.Inspect()
+
+	// swept rconns keep their idle time
+	p.SetConnMaxIdleTime(30 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if after := p.Inspect(); len(after) == 2 && !after[0].LastUsed.Equal(before[0].LastUsed) {
+		t.Errorf("HealthSweep error. LastUsed should not change")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := p.Stats().IdleTimeoutClosed; n != 2 {
+		t.Errorf("IdleTimeoutClosed error. Expecting %d, got %d", 2, n)
+	}
+}
+
+func TestPool_SetConnMaxIdleTimeMinIdle(t *testing.T) {
+	p, err := NewChannelPool(4, MaximumCap, newStubFactory(), WithMinIdle(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.SetConnMaxIdleTime(20 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	// the reaper doesn't go below the min idle floor
+	if n := p.Stats().IdleTimeoutClosed; n != 2 {
+		t.Errorf("IdleTimeoutClosed error. Expecting %d, got %d", 2, n)
+	}
+	if n := p.Stats().Created; n != 4 {
+		t.Errorf("SetConnMaxIdleTime error. Expecting %d created, got %d", 4, n)
+	}
+	if p.Len() != 2 {
+		t.Errorf("SetConnMaxIdleTime error. Expecting %d idle, got %d", 2, p.Len())
+	}
+}
+
+func TestPool_PreferFreshAfter(t *testing.T) {
+	p, err := NewChannelPool(1, 2, newStubFactory(),
+		WithPreferFreshAfter(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	time.Sleep(30 * time.Millisecond)
+
+	// spare capacity, the stale rconn is retired
+	rconn, _ := p.Get()
+	if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id != 2 {
+		t.Errorf("PreferFreshAfter error. Expecting rconn #2, got #%d", stub.id)
+	}
+	if closed := p.Stats().Closed; closed != 1 {
+		t.Errorf("PreferFreshAfter error. Expecting %d closed, got %d", 1, closed)
+	}
+	rconn2, _ := p.Get()
+	rconn.Close()
+	time.Sleep(30 * time.Millisecond)
+
+	// at capacity, the stale rconn is reused
+	rconn, _ = p.Get()
+	if stub := rconn.(*PoolRconn).RpcAble.(*stubRconn); stub.id != 2 {
+		t.Errorf("PreferFreshAfter error. Expecting rconn #2, got #%d", stub.id)
+	}
+	rconn.Close()
+	rconn2.Close()
+}
+
+func TestPool_SoftCap(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory(), WithSoftCap(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// burst above the soft cap
+	var rconns []Conn
+	for i := 0; i < 6; i++ {
+		rconn, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+		rconns = append(rconns, rconn)
+	}
+	if open := p.Stats().Open; open != 6 {
+		t.Errorf("SoftCap error. Expecting %d open, got %d", 6, open)
+	}
+
+	// overflow rconns are closed, the pool settling back to the soft cap
+	for _, rconn := range rconns {
+		rconn.Close()
+	}
+	stats := p.Stats()
+	if stats.Open != 3 || stats.Idle != 3 || stats.Closed != 3 {
+		t.Errorf("SoftCap error. Expecting 3 open, 3 idle and 3 closed, got %+v", stats)
+	}
+}
+
+func TestPool_GetN(t *testing.T) {
+	p, err := NewChannelPool(3, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetMaxOpenConns(3)
+
+	rconns, err := p.GetN(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("GetN error: %s", err)
+	}
+	if len(rconns) != 3 {
+		t.Errorf("GetN error. Expecting %d rconns, got %d", 3, len(rconns))
+	}
+	if p.Len() != 0 {
+		t.Errorf("GetN error. Expecting no idle rconn, got %d", p.Len())
+	}
+	for _, rconn := range rconns {
+		rconn.Close()
+	}
+
+	// not enough open slots, the partially got ones are returned
+	rconn, _ := p.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetN(ctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("GetN error. Expecting %v, got %v", context.DeadlineExceeded, err)
+	}
+	if stats := p.Stats(); stats.InUse != 1 || stats.Idle != 2 {
+		t.Errorf("GetN error. Expecting 1 in use and 2 idle, got %+v", stats)
+	}
+	rconn.Close()
+
+	if _, err := p.GetN(context.Background(), MaximumCap+1); err == nil {
+		t.Errorf("GetN error. Expecting an error beyond the maximum capacity")
+	}
+
+	// more than the open limit fails fast
+	if _, err := p.GetN(context.Background(), 4); err == nil {
+		t.Errorf("GetN error. Expecting an error beyond the open limit")
+	}
+}
+
+func TestPool_MaxWaiters(t *testing.T) {
+	p, err := NewChannelPool(0, MaximumCap, newStubFactory(), WithMaxWaiters(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.SetMaxOpenConns(1)
+	rconn, _ := p.Get()
+
+	// fill the waiters queue
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			rconn, err := p.Get()
+			if err == nil {
+				rconn.Close()
+			}
+			errs <- err
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Waiters != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := p.Stats().Waiters; n != 2 {
+		t.Fatalf("MaxWaiters error. Expecting %d waiters, got %d", 2, n)
+	}
+
+	// the next one fails fast
+	start := time.Now()
+	if _, err := p.Get(); err != ErrPoolExhausted {
+		t.Errorf("MaxWaiters error. Expecting %v, got %v", ErrPoolExhausted, err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("MaxWaiters error. Get() should fail fast, took %s", elapsed)
+	}
+	if n := p.Stats().ExhaustedCount; n != 1 {
+		t.Errorf("MaxWaiters error. Expecting %d exhausted, got %d", 1, n)
+	}
+
+	// waiters are served once the rconn is returned
+	rconn.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Errorf("MaxWaiters error. Expecting no error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("MaxWaiters error. Get() still waiting")
+		}
+	}
+	if n := p.Stats().Waiters; n != 0 {
+		t.Errorf("MaxWaiters error. Expecting no waiters, got %d", n)
+	}
+}
+
+func TestPool_ReturnToFront(t *testing.T) {
+	p, _ := NewChannelPool(0, 2, newStubFactory(), WithReturnToFront(true))
+	defer p.Close()
+	c := p.(*channelPool)
+
+	rconnA, _ := p.Get()
+	rconnB, _ := p.Get()
+	stubB := rconnB.(*PoolRconn).RpcAble
+
+	rconnA.Close()
+	time.Sleep(20 * time.Millisecond)
+	rconnB.Close()
+
+	// the last returned rconn is handed out first
+	rconn, _ := p.Get()
+	if rconn.(*PoolRconn).RpcAble != stubB {
+		t.Errorf("ReturnToFront error. Expecting the last returned rconn")
+	}
+	rconn.Close()
+
+	if infos := p.Inspect(); len(infos) != 2 || !infos[0].LastUsed.After(infos[1].LastUsed) {
+		t.Errorf("ReturnToFront error. Expecting the oldest idle rconn at the back, got %+v", infos)
+	}
+
+	// while the reaper targets the oldest one
+	atomic.StoreInt64(&c.maxIdleTime, int64(15*time.Millisecond))
+	c.reap()
+	if p.Len() != 1 {
+		t.Fatalf("ReturnToFront error. Expecting %d idle, got %d", 1, p.Len())
+	}
+	rconn, _ = p.Get()
+	defer rconn.Close()
+	if rconn.(*PoolRconn).RpcAble != stubB {
+		t.Errorf("ReturnToFront error. Expecting the oldest rconn to be reaped")
+	}
+	if stats := p.Stats(); stats.IdleTimeoutClosed != 1 {
+		t.Errorf("ReturnToFront error. Expecting %d reaped, got %d", 1, stats.IdleTimeoutClosed)
+	}
+}
+
+func TestPool_ReturnToFrontConcurrent(t *testing.T) {
+	p, _ := NewChannelPool(20, 40, newStubFactory(), WithReturnToFront(true))
+	defer p.Close()
+
+	// returning rconns never makes the idle ones look all taken
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				rconn, err := p.Get()
+				if err != nil {
+					t.Errorf("Get error: %s", err)
+					return
+				}
+				rconn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stats := p.Stats(); stats.Created != 20 || stats.Idle != 20 {
+		t.Errorf("ReturnToFront error. Expecting %d created and idle, got %+v", 20, stats)
+	}
+}
+
+func TestPool_ReturnToFrontEvict(t *testing.T) {
+	p, _ := NewChannelPool(2, 3, newStubFactory(), WithReturnToFront(true),
+		WithFullPolicy(FullPolicyEvictOldest))
+	defer p.Close()
+	p.SetMaxIdleConns(2)
+
+	rconnA, _ := p.Get()
+	rconnB, _ := p.Get()
+	rconnC, _ := p.Get()
+	stubB := rconnB.(*PoolRconn).RpcAble
+	stubC := rconnC.(*PoolRconn).RpcAble
+	rconnA.Close()
+	rconnB.Close()
+	rconnC.Close()
+
+	// C is handed out first, then B, A having been evicted
+	for _, expected := range []RpcAble{stubC, stubB} {
+		rconn, _ := p.Get()
+		if rconn.(*PoolRconn).RpcAble != expected {
+			t.Errorf("ReturnToFront error. Expecting %v, got %v", expected, rconn.(*PoolRconn).RpcAble)
+		}
+		defer rconn.Close()
+	}
+	if stats := p.Stats(); stats.MaxIdleClosed != 1 {
+		t.Errorf("ReturnToFront error. Expecting %d evicted, got %d", 1, stats.MaxIdleClosed)
+	}
+}
+
+func TestPool_MaxCumulativeUseTime(t *testing.T) {
+	fc := newFakeClock()
+	p, _ := NewChannelPool(1, 1, newStubFactory(),
+		withClock(fc), WithMaxCumulativeUseTime(100*time.Millisecond))
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	fc.Advance(60 * time.Millisecond)
+	rconn.Close()
+
+	// idle time doesn't count
+	fc.Advance(time.Second)
+
+	rconn, _ = p.Get()
+	if rconn.(*PoolRconn).RpcAble != stub {
+		t.Fatal("MaxCumulativeUseTime error. Expecting the same rconn")
+	}
+	fc.Advance(30 * time.Millisecond)
+	if accepted, _ := rconn.TryRelease(); !accepted || stub.isClosed() {
+		t.Fatal("MaxCumulativeUseTime error. Expecting the rconn to be kept after 90ms")
+	}
+
+	rconn, _ = p.Get()
+	fc.Advance(30 * time.Millisecond)
+	if accepted, _ := rconn.TryRelease(); accepted || !stub.isClosed() {
+		t.Error("MaxCumulativeUseTime error. Expecting the rconn to be retired after 120ms")
+	}
+	if p.Len() != 0 {
+		t.Errorf("MaxCumulativeUseTime error. Expecting %d, got %d", 0, p.Len())
+	}
+}
+
+func TestPool_OverflowAllowance(t *testing.T) {
+	p, _ := NewChannelPool(0, 2, newStubFactory(), WithOverflowAllowance(1))
+	defer p.Close()
+	p.SetMaxOpenConns(2)
+
+	// saturate the pool
+	var regular []Conn
+	for i := 0; i < 2; i++ {
+		rconn, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+		regular = append(regular, rconn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("GetContext error. Expecting %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	rconn, err := p.GetPriority(context.Background())
+	if err != nil {
+		t.Fatalf("GetPriority error: %s", err)
+	}
+	if open := p.Stats().Open; open != 3 {
+		t.Errorf("GetPriority error. Expecting %d open, got %d", 3, open)
+	}
+
+	// no allowance left
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetPriority(ctx); err != context.DeadlineExceeded {
+		t.Errorf("GetPriority error. Expecting %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// regular rconns are still pooled while the overflow one is out
+	if accepted, _ := regular[0].TryRelease(); !accepted {
+		t.Error("OverflowAllowance error. Expecting the regular rconn to be pooled")
+	}
+
+	// the overflow rconn is not pooled
+	stub := rconn.(*PoolRconn).RpcAble.(*stubRconn)
+	if accepted, _ := rconn.TryRelease(); accepted || !stub.isClosed() {
+		t.Error("OverflowAllowance error. Expecting the overflow rconn to be closed")
+	}
+	regular[1].Close()
+	if stats := p.Stats(); stats.Open != 2 || stats.Idle != 2 {
+		t.Errorf("OverflowAllowance error. Expecting %d open and idle, got %+v", 2, stats)
+	}
+}
+
+func TestPool_EagerReplace(t *testing.T) {
+	p, _ := NewChannelPool(3, 5, newStubFactory(), WithEagerReplace(true))
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	rconn.MarkUnusable()
+	rconn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := p.Stats(); stats.Idle != 3 || stats.Open != 3 || stats.Created != 4 {
+		t.Errorf("EagerReplace error. Expecting %d idle and open, got %+v", 3, stats)
+	}
+
+	// returned rconns are not replaced
+	rconn, _ = p.Get()
+	rconn.Close()
+	time.Sleep(10 * time.Millisecond)
+	if created := p.Stats().Created; created != 4 {
+		t.Errorf("EagerReplace error. Expecting %d created, got %d", 4, created)
+	}
+
+	// rconns closed on purpose are not replaced
+	if n := p.Shrink(1); n != 1 {
+		t.Errorf("Shrink error. Expecting %d closed, got %d", 1, n)
+	}
+	p.SetConnMaxIdleTime(5 * time.Millisecond)
+	deadline = time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats := p.Stats(); stats.Idle != 0 || stats.Created != 4 {
+		t.Errorf("EagerReplace error. Expecting no idle and %d created, got %+v", 4, stats)
+	}
+
+	// disabled by default
+	p2, _ := NewChannelPool(3, 5, newStubFactory())
+	defer p2.Close()
+	rconn, _ = p2.Get()
+	rconn.MarkUnusable()
+	rconn.Close()
+	time.Sleep(10 * time.Millisecond)
+	if p2.Len() != 2 {
+		t.Errorf("EagerReplace error. Expecting %d idle, got %d", 2, p2.Len())
+	}
+}
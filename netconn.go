@@ -0,0 +1,221 @@
+package pool
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"time"
+)
+
+// errNotRPC is the error returned by the RPC methods of a raw
+// network connection pooled by a NetConnPool.
+var errNotRPC = errors.New("not an RPC connection")
+
+// NetConnPool is a pool of raw network connections, relying on the
+// same machinery as Pool.
+type NetConnPool interface {
+	// Get returns a new network connection from the pool. Closing it
+	// puts it back to the pool. Closing it when the pool is destroyed
+	// or full will be counted as an error.
+	Get() (net.Conn, error)
+
+	// Put adopts a network connection created outside the pool, as
+	// Pool.Put() does. A network connection returned by Get() is
+	// simply put back to the pool.
+	Put(conn net.Conn) error
+
+	// Len returns the current number of idle network connections of
+	// the pool.
+	Len() int
+
+	// Close closes the pool and all its idle network connections, as
+	// Pool.Close() does.
+	Close() error
+
+	// Stats returns the statistics of the pool.
+	Stats() Stats
+}
+
+// netConnPool implements NetConnPool on top of a channelPool.
+type netConnPool struct {
+	c *channelPool
+}
+
+// netRconn adapts a net.Conn to the RpcAble interface, so it can be
+// pooled by a channelPool. Its RPC methods always fail. As net.Conn
+// has a RemoteAddr() method, it is Addressable.
+type netRconn struct {
+	net.Conn
+}
+
+func (n netRconn) Call(string, interface{}, interface{}) error {
+	return errNotRPC
+}
+
+func (n netRconn) Go(serviceMethod string, args interface{}, reply interface{}, done chan *rpc.Call) *rpc.Call {
+	if done == nil {
+		done = make(chan *rpc.Call, 1)
+	}
+	call := &rpc.Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Error:         errNotRPC,
+		Done:          done,
+	}
+	select {
+	case done <- call:
+	default:
+	}
+	return call
+}
+
+// NewNetConnPool returns a new pool of raw network connections created
+// by dial, with an initial capacity and maximum capacity, see
+// NewChannelPool(). opts can be used to tune the pool behavior.
+func NewNetConnPool(initialCap, maxCap int, dial func() (net.Conn, error), opts ...Option) (NetConnPool, error) {
+	var factory Factory
+	if dial != nil {
+		factory = func() (RpcAble, error) {
+			conn, err := dial()
+			if err != nil {
+				return nil, err
+			}
+			return netRconn{conn}, nil
+		}
+	}
+
+	p, err := NewChannelPool(initialCap, maxCap, factory, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return netConnPool{c: p.(*channelPool)}, nil
+}
+
+// Get implements the NetConnPool interfaces Get() method.
+func (n netConnPool) Get() (net.Conn, error) {
+	rconn, err := n.c.Get()
+	if err != nil {
+		return nil, err
+	}
+	p := rconn.(*PoolRconn)
+	return &PoolNetConn{conn: p.RpcAble.(netRconn).Conn, rconn: p}, nil
+}
+
+// Put implements the NetConnPool interfaces Put() method.
+func (n netConnPool) Put(conn net.Conn) error {
+	if conn == nil {
+		return n.c.Put(nil)
+	}
+	if p, ok := conn.(*PoolNetConn); ok {
+		if p.closed || p.rconn.c != n.c {
+			n.c.badPut()
+			return errWrongPool
+		}
+		return p.Close()
+	}
+	return n.c.Put(netRconn{conn})
+}
+
+// Len implements the NetConnPool interfaces Len() method.
+func (n netConnPool) Len() int {
+	return n.c.Len()
+}
+
+// Close implements the NetConnPool interfaces Close() method.
+func (n netConnPool) Close() error {
+	return n.c.Close()
+}
+
+// Stats implements the NetConnPool interfaces Stats() method.
+func (n netConnPool) Stats() Stats {
+	return n.c.Stats()
+}
+
+// PoolNetConn is the network connection returned by NetConnPool.Get().
+// Closing it puts it back to the pool, as PoolRconn does.
+//
+// Once closed, a PoolNetConn is definitely detached from its network
+// connection and fails cleanly if used.
+type PoolNetConn struct {
+	conn   net.Conn
+	rconn  *PoolRconn
+	closed bool
+}
+
+// Close puts the network connection back to the pool instead of
+// closing it.
+func (p *PoolNetConn) Close() error {
+	if p.closed {
+		return errRconnClosed
+	}
+	err := p.rconn.Close()
+	*p = PoolNetConn{closed: true}
+	return err
+}
+
+// MarkUnusable marks the network connection not usable any more, to
+// let the pool close it instead of returning it to pool.
+func (p *PoolNetConn) MarkUnusable() {
+	if !p.closed {
+		p.rconn.MarkUnusable()
+	}
+}
+
+// Read implements the net.Conn interface.
+func (p *PoolNetConn) Read(b []byte) (int, error) {
+	if p.closed {
+		return 0, errRconnClosed
+	}
+	return p.conn.Read(b)
+}
+
+// Write implements the net.Conn interface.
+func (p *PoolNetConn) Write(b []byte) (int, error) {
+	if p.closed {
+		return 0, errRconnClosed
+	}
+	return p.conn.Write(b)
+}
+
+// LocalAddr implements the net.Conn interface. It returns nil if p
+// is closed.
+func (p *PoolNetConn) LocalAddr() net.Addr {
+	if p.closed {
+		return nil
+	}
+	return p.conn.LocalAddr()
+}
+
+// RemoteAddr implements the net.Conn interface. It returns nil if p
+// is closed.
+func (p *PoolNetConn) RemoteAddr() net.Addr {
+	if p.closed {
+		return nil
+	}
+	return p.conn.RemoteAddr()
+}
+
+// SetDeadline implements the net.Conn interface.
+func (p *PoolNetConn) SetDeadline(t time.Time) error {
+	if p.closed {
+		return errRconnClosed
+	}
+	return p.conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements the net.Conn interface.
+func (p *PoolNetConn) SetReadDeadline(t time.Time) error {
+	if p.closed {
+		return errRconnClosed
+	}
+	return p.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements the net.Conn interface.
+func (p *PoolNetConn) SetWriteDeadline(t time.Time) error {
+	if p.closed {
+		return errRconnClosed
+	}
+	return p.conn.SetWriteDeadline(t)
+}
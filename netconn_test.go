@@ -0,0 +1,193 @@
+package pool
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// echoServer starts a TCP server echoing back what it receives and
+// returns a function dialing it.
+func echoServer(t *testing.T) func() (net.Conn, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return func() (net.Conn, error) {
+		return net.Dial("tcp", l.Addr().String())
+	}
+}
+
+func echo(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write error: %s", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Read error: %s", err)
+	}
+	if string(buf) != msg {
+		t.Errorf("Echo error. Expecting %q, got %q", msg, buf)
+	}
+}
+
+func TestNetConnPool_New(t *testing.T) {
+	p, err := NewNetConnPool(InitialCap, MaximumCap, echoServer(t))
+	if err != nil {
+		t.Fatalf("New error: %s", err)
+	}
+	defer p.Close()
+
+	if p.Len() != InitialCap {
+		t.Errorf("Len error. Expecting %d, got %d", InitialCap, p.Len())
+	}
+
+	if _, err := NewNetConnPool(0, 5, nil); err == nil {
+		t.Errorf("New error. Expecting an error for a nil dial")
+	}
+	if _, err := NewNetConnPool(6, 5, echoServer(t)); err == nil {
+		t.Errorf("New error. Expecting an error for invalid capacities")
+	}
+}
+
+func TestNetConnPool_GetClose(t *testing.T) {
+	p, _ := NewNetConnPool(1, 2, echoServer(t))
+	defer p.Close()
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	echo(t, conn, "hello")
+	raw := conn.(*PoolNetConn).conn
+	if p.Len() != 0 {
+		t.Errorf("Get error. Expecting %d, got %d", 0, p.Len())
+	}
+
+	// Close() puts the connection back to the pool
+	if err := conn.Close(); err != nil {
+		t.Errorf("Close error: %s", err)
+	}
+	if p.Len() != 1 {
+		t.Errorf("Close error. Expecting %d, got %d", 1, p.Len())
+	}
+	if err := conn.Close(); err == nil {
+		t.Errorf("Close error. A second Close() should fail")
+	}
+	if _, err := conn.Write([]byte("x")); err != errRconnClosed {
+		t.Errorf("Write error. Expecting %v, got %v", errRconnClosed, err)
+	}
+
+	// and the same raw connection is reused
+	conn, _ = p.Get()
+	if conn.(*PoolNetConn).conn != raw {
+		t.Errorf("Get error. Expecting the pooled connection")
+	}
+	echo(t, conn, "again")
+
+	// unusable connections are closed
+	conn.(*PoolNetConn).MarkUnusable()
+	conn.Close()
+	if p.Len() != 0 {
+		t.Errorf("Close error. Expecting %d, got %d", 0, p.Len())
+	}
+	if _, err := raw.Write([]byte("x")); err == nil {
+		t.Errorf("MarkUnusable error. Expecting the connection to be closed")
+	}
+}
+
+func TestNetConnPool_Put(t *testing.T) {
+	dial := echoServer(t)
+	p, _ := NewNetConnPool(0, 2, dial)
+	defer p.Close()
+
+	raw, _ := dial()
+	if err := p.Put(raw); err != nil {
+		t.Fatalf("Put error: %s", err)
+	}
+	conn, _ := p.Get()
+	if conn.(*PoolNetConn).conn != raw {
+		t.Errorf("Put error. Expecting the adopted connection")
+	}
+	echo(t, conn, "adopted")
+
+	if err := p.Put(conn); err != nil {
+		t.Errorf("Put error: %s", err)
+	}
+	if err := p.Put(conn); err != errWrongPool {
+		t.Errorf("Put error. Expecting %v, got %v", errWrongPool, err)
+	}
+	if err := p.Put(nil); err == nil {
+		t.Errorf("Put error. Expecting an error for a nil connection")
+	}
+	if stats := p.Stats(); stats.BadPuts != 2 {
+		t.Errorf("Put error. Expecting %d bad puts, got %d", 2, stats.BadPuts)
+	}
+}
+
+func TestNetConnPool_Close(t *testing.T) {
+	p, _ := NewNetConnPool(InitialCap, MaximumCap, echoServer(t))
+	conn, _ := p.Get()
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close error: %s", err)
+	}
+	if p.Len() != 0 {
+		t.Errorf("Close error. Expecting %d, got %d", 0, p.Len())
+	}
+	if _, err := p.Get(); err != ErrClosed {
+		t.Errorf("Get error. Expecting %v, got %v", ErrClosed, err)
+	}
+	// returned once the pool is closed, the connection is closed
+	raw := conn.(*PoolNetConn).conn
+	conn.Close()
+	if _, err := raw.Write([]byte("x")); err == nil {
+		t.Errorf("Close error. Expecting the connection to be closed")
+	}
+}
+
+func TestNetConnPoolConcurrent(t *testing.T) {
+	p, _ := NewNetConnPool(0, MaximumCap, echoServer(t))
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < MaximumCap; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 10; k++ {
+				conn, err := p.Get()
+				if err != nil {
+					t.Errorf("Get error: %s", err)
+					return
+				}
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					t.Errorf("Write error: %s", err)
+				}
+				buf := make([]byte, 4)
+				if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+					t.Errorf("Read error: %v, %q", err, buf)
+				}
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+}
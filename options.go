@@ -0,0 +1,502 @@
+package pool
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Option is a functional option used to configure a pool in
+// NewChannelPool.
+type Option func(*channelPool)
+
+// Logger is the interface used by the pool to report events that
+// cannot be returned as errors. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// stdLogger is the default Logger, using the standard log package.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// WithLogger sets the logger used by the pool. Defaults to the
+// standard log package.
+func WithLogger(logger Logger) Option {
+	return func(c *channelPool) {
+		c.logger = logger
+	}
+}
+
+// WithStatsLogging makes the pool log its statistics every interval
+// using the WithLogger() logger, on one line of key=value pairs, until
+// it is closed. A zero interval disables it.
+func WithStatsLogging(interval time.Duration) Option {
+	return func(c *channelPool) {
+		if interval < 0 {
+			interval = 0
+		}
+		c.statsInterval = interval
+	}
+}
+
+// WithOnClose sets a hook called each time the pool closes an
+// RPC-able connection. If the hook panics, the panic is recovered
+// and logged. The hook can be called concurrently, for example by
+// CloseContext() or WithAsyncClose() workers.
+func WithOnClose(fn func(RpcAble)) Option {
+	return func(c *channelPool) {
+		c.onClose = fn
+	}
+}
+
+// WithOnGet sets a hook called each time an RPC-able connection is
+// checked out, with the Pool.GetLabeled() label, empty for the other
+// Get() flavors, for example to attribute the pool usage to callers.
+// If the hook panics, the panic is recovered and logged. The hook can
+// be called concurrently.
+func WithOnGet(fn func(rconn Conn, label string)) Option {
+	return func(c *channelPool) {
+		c.onGet = fn
+	}
+}
+
+// WithOnBadPut sets a hook called each time a nil RPC-able
+// connection, or belonging to another pool, or already returned, is
+// put back to the pool, see Stats().BadPuts. If the hook panics, the
+// panic is recovered and logged. The hook can be called concurrently.
+func WithOnBadPut(fn func()) Option {
+	return func(c *channelPool) {
+		c.onBadPut = fn
+	}
+}
+
+// WithCloseFunc sets the function used by the pool to close an
+// RPC-able connection, for example to gracefully tear it down. It is
+// used everywhere the pool closes an RPC-able connection. Like
+// WithOnClose() hook, it can be called concurrently. If it panics, the
+// panic is recovered and logged. Defaults to calling its Close()
+// method.
+func WithCloseFunc(fn func(RpcAble) error) Option {
+	return func(c *channelPool) {
+		c.closeFunc = fn
+	}
+}
+
+// WithAsyncClose makes the pool close the RPC-able connections
+// returned to a full pool or marked unusable in the background, so a
+// slow Close() doesn't delay the returning goroutine. At most 4
+// background closes run at the same time and up to 64 can be queued,
+// the next ones being closed synchronously. Pool Close() waits for
+// the queued ones to be closed.
+func WithAsyncClose(enabled bool) Option {
+	return func(c *channelPool) {
+		c.asyncClose = enabled
+	}
+}
+
+// FullPolicy defines what happens when an RPC-able connection is
+// returned to a full pool.
+type FullPolicy int
+
+const (
+	// FullPolicyCloseReturned closes the returned RPC-able
+	// connection. This is the default.
+	FullPolicyCloseReturned FullPolicy = iota
+	// FullPolicyEvictOldest closes the oldest idle RPC-able connection
+	// and keeps the returned one.
+	FullPolicyEvictOldest
+)
+
+// WithFullPolicy sets the policy applied when an RPC-able connection
+// is returned to a full pool. Defaults to FullPolicyCloseReturned.
+func WithFullPolicy(policy FullPolicy) Option {
+	return func(c *channelPool) {
+		c.fullPolicy = policy
+	}
+}
+
+// WithFillTolerance makes NewChannelPool() tolerate up to
+// maxFailures factory errors during the initial fill. Each error is
+// logged and the pool is returned with fewer than initialCap idle
+// RPC-able connections. Defaults to 0, any error failing the pool
+// creation.
+func WithFillTolerance(maxFailures int) Option {
+	return func(c *channelPool) {
+		c.fillTolerance = maxFailures
+	}
+}
+
+// WithFillValidation makes NewChannelPool() run the WithValidator()
+// validator against each RPC-able connection created during the
+// initial fill. A validation failure closes the RPC-able connection
+// and counts as a factory error, see WithFillTolerance(). This
+// catches dead-on-arrival RPC-able connections at startup.
+func WithFillValidation() Option {
+	return func(c *channelPool) {
+		c.fillValidation = true
+	}
+}
+
+// WithMinIdle makes the pool maintain at least n idle RPC-able
+// connections in the background, dialing new ones as soon as the
+// idle count drops below n. n is capped to maxCap.
+func WithMinIdle(n int) Option {
+	return func(c *channelPool) {
+		c.minIdle = n
+	}
+}
+
+// WithSoftCap makes the pool keep at most soft open RPC-able
+// connections, idle or checked out, in steady state. Under load, Get()
+// still dials new ones, but those returned while more than soft are
+// open are closed instead of being pooled, so the pool settles back
+// to soft once the burst is over. soft is capped to maxCap, the open
+// RPC-able connections remaining limited by SetMaxOpenConns() only.
+func WithSoftCap(soft int) Option {
+	return func(c *channelPool) {
+		if soft < 0 {
+			soft = 0
+		}
+		c.softCap = int64(soft)
+	}
+}
+
+// WithMaxIdle sets the maximum number of idle RPC-able connections
+// kept by the pool, as SetMaxIdleConns() does but from its creation:
+// up to maxCap RPC-able connections can be open during a burst, but
+// the returned ones exceeding n are closed instead of staying idle.
+// It also bounds the initial capacity and WithMinIdle().
+func WithMaxIdle(n int) Option {
+	return func(c *channelPool) {
+		c.maxIdle = n
+	}
+}
+
+// WithOverflowAllowance allows GetPriority() to dial up to n RPC-able
+// connections beyond the SetMaxOpenConns() limit instead of waiting
+// for one to be returned, as a pressure-relief valve for high-priority
+// work. These overflow RPC-able connections are closed instead of
+// being pooled once returned. The shared limiter, if any, still
+// applies.
+func WithOverflowAllowance(n int) Option {
+	return func(c *channelPool) {
+		if n < 0 {
+			n = 0
+		}
+		c.overflowAllowance = int64(n)
+	}
+}
+
+// WithEagerReplace makes the pool dial in the background a
+// replacement for each RPC-able connection it retires as unhealthy or
+// expired, as long as it is open and holds fewer idle RPC-able
+// connections than its initial capacity or WithMinIdle(), the
+// highest, so a warm pool keeps its size instead of waiting for the
+// next Get() calls to dial. Replacements are dialed one at a time and
+// are subject to SetMaxOpenConns(), WithSoftCap() and the idle
+// capacity. The RPC-able connections closed on purpose, by Shrink(),
+// SetMaxIdleConns() or for their idle time, are not replaced.
+func WithEagerReplace(eagerReplace bool) Option {
+	return func(c *channelPool) {
+		c.eagerReplace = eagerReplace
+	}
+}
+
+// WithPreferFreshAfter makes Get() close the idle RPC-able
+// connections older than d instead of handing them out, as long as
+// fewer than maxCap RPC-able connections are open, so a fresh one is
+// handed out instead. Contrary to SetConnMaxLifetime(), it is a
+// preference: at capacity, old RPC-able connections are still reused.
+func WithPreferFreshAfter(d time.Duration) Option {
+	return func(c *channelPool) {
+		c.preferFreshAfter = d
+	}
+}
+
+// WithMaxCumulativeUseTime retires the RPC-able connections once the
+// total time they spent checked out, summed across all their uses,
+// exceeds d: they are closed when returned to the pool instead of
+// being put back. Contrary to SetConnMaxLifetime(), an RPC-able
+// connection rarely used lives as long as needed, while a busy one,
+// which may have accumulated server-side state, is recycled early.
+func WithMaxCumulativeUseTime(d time.Duration) Option {
+	return func(c *channelPool) {
+		c.maxUseTime = d
+	}
+}
+
+// WithReturnToFront makes the RPC-able connections returned to the
+// pool after use the next ones handed out, instead of the last ones,
+// so a small working set of RPC-able connections stays warm. The
+// oldest idle ones are then at the back, so the first ones evicted
+// by FullPolicyEvictOldest and reaped by SetConnMaxIdleTime().
+// Returning an RPC-able connection costs a rotation of the idle ones,
+// so it gets slower as the number of idle RPC-able connections grows.
+func WithReturnToFront(returnToFront bool) Option {
+	return func(c *channelPool) {
+		c.returnToFront = returnToFront
+	}
+}
+
+// WithNoFactory makes the pool never create RPC-able connections, so
+// the factory passed to NewChannelPool() can be nil. The pool is then
+// only filled by Put() or SwapConnections(), for example by a
+// separate privileged component, and Get() and its variants fail with
+// ErrNoIdle when there is no idle RPC-able connection. The initial
+// capacity must be 0, WithMinIdle() is ignored and Grow() fails.
+func WithNoFactory() Option {
+	return func(c *channelPool) {
+		c.noFactory = true
+	}
+}
+
+// WithNoSyncDial makes Get() and its variants fail immediately with
+// ErrNoIdle instead of calling the factory when there is no idle
+// RPC-able connection, so no dial ever occurs on the request path.
+// The pool is then only filled by NewChannelPool(), Grow(), Put()
+// and the WithMinIdle() background maintenance, woken up by such a
+// failure.
+func WithNoSyncDial(noSyncDial bool) Option {
+	return func(c *channelPool) {
+		c.noSyncDial = noSyncDial
+	}
+}
+
+// WithHealthSweep makes the pool validate all its idle RPC-able
+// connections every interval, closing the ones for which validator
+// returns an error. Idle RPC-able connections are checked one at a
+// time, so at most one of them is held out of the pool by the sweep.
+func WithHealthSweep(interval time.Duration, validator func(RpcAble) error) Option {
+	return func(c *channelPool) {
+		c.sweepInterval = interval
+		c.sweepValidator = validator
+	}
+}
+
+// maxIntervalJitter is the maximum fraction accepted by
+// WithIntervalJitter().
+const maxIntervalJitter = 0.5
+
+// WithIntervalJitter randomly shifts each wake up of the background
+// loops (min idle maintainer, health sweep, reaper and stats logging)
+// by up to plus or minus fraction of their interval, so pools sharing
+// the same settings don't wake up all at once. fraction is capped to
+// 0.5.
+// Defaults to 0, no jitter.
+func WithIntervalJitter(fraction float64) Option {
+	return func(c *channelPool) {
+		if fraction > maxIntervalJitter {
+			fraction = maxIntervalJitter
+		}
+		c.intervalJitter = fraction
+	}
+}
+
+// WithValidator sets a validator called by Get() against each idle
+// RPC-able connection before handing it out. RPC-able connections
+// for which validator returns an error are closed. Newly created
+// RPC-able connections are not validated.
+func WithValidator(validator func(RpcAble) error) Option {
+	return func(c *channelPool) {
+		c.validator.Store(validatorFunc{validator})
+	}
+}
+
+// WithPingIfIdleLongerThan sets a ping called by Get() against the
+// idle RPC-able connections idle for d or more before handing them
+// out, as they are the most likely to have died. RPC-able connections
+// for which ping returns an error are closed and Get() goes on with
+// another one. Contrary to WithValidator(), recently used RPC-able
+// connections are handed out without any check.
+func WithPingIfIdleLongerThan(d time.Duration, ping func(RpcAble) error) Option {
+	return func(c *channelPool) {
+		c.pingIdleAfter = d
+		c.pingIdle = ping
+	}
+}
+
+// WithConnDecorator sets a function wrapping each new RPC-able
+// connection just after the factory created it, typically to add
+// metrics, tracing or logging around its calls. The decorated RPC-able
+// connection is the one pooled, so decorate is called once per
+// underlying RPC-able connection and not on each Get(). The RPC-able
+// connections adopted by Put() or SwapConnections() are not
+// decorated. decorate must not return nil.
+//
+// As the pool only sees the decorated RPC-able connection, the
+// optional interfaces of the underlying one, Sticky, IdleLimited,
+// Drainable and Addressable, are lost unless the decorated one
+// implements them too, typically by forwarding them.
+func WithConnDecorator(decorate func(RpcAble) RpcAble) Option {
+	return func(c *channelPool) {
+		c.decorator = decorate
+	}
+}
+
+// WithPrime sets a one-time setup, typically an authentication or a
+// database selection, run against each new RPC-able connection just
+// after its successful dial, outside of the WithDialTimeout() one. A
+// priming failure closes the RPC-able connection and counts as a
+// dial failure, so it is retried as set by WithDialAttempts() and
+// WithDialBackoff().
+func WithPrime(prime func(ctx context.Context, rconn RpcAble) error) Option {
+	return func(c *channelPool) {
+		c.prime = prime
+	}
+}
+
+// WithRePrime makes Get() also run the WithPrime() setup against the
+// idle RPC-able connections before handing them out, for servers
+// forgetting it between uses. RPC-able connections failing it are
+// closed and Get() goes on with another one.
+func WithRePrime(rePrime bool) Option {
+	return func(c *channelPool) {
+		c.rePrime = rePrime
+	}
+}
+
+// WithValidateOnPut sets a validator called against each RPC-able
+// connection put back to the pool. RPC-able connections for which
+// validator returns an error are closed instead of being pooled, as
+// if marked unusable.
+func WithValidateOnPut(validator func(RpcAble) error) Option {
+	return func(c *channelPool) {
+		c.putValidator = validator
+	}
+}
+
+// WithSharedLimiter makes the pool count its RPC-able connections
+// against l, so the pools sharing l collectively never hold more than
+// l.Max() open RPC-able connections. Once the limit is reached, Get()
+// calls needing a new RPC-able connection wait for one to be closed
+// in any of these pools, as they do once SetMaxOpenConns() is
+// reached, so WithMaxWaiters() applies. The initial RPC-able
+// connections are only created as long as the limit allows it, and
+// Put() fails with ErrFull if it is reached.
+func WithSharedLimiter(l *Limiter) Option {
+	return func(c *channelPool) {
+		c.limiter = l
+	}
+}
+
+// WithMaxWaiters limits to n the number of Get() calls waiting for
+// an RPC-able connection once SetMaxOpenConns() is reached. Further
+// calls fail immediately with ErrPoolExhausted instead of queuing,
+// shedding load during a backend outage. A zero n means no limit.
+func WithMaxWaiters(n int) Option {
+	return func(c *channelPool) {
+		if n < 0 {
+			n = 0
+		}
+		c.maxWaiters = int64(n)
+	}
+}
+
+// WithRetireOn sets the predicate used by Pool.WithConn() to decide
+// whether the RPC-able connection has to be closed instead of put
+// back to the pool, depending on the non-nil error returned by the
+// user function. Typically, an application error returned by the
+// remote side does not need to retire the RPC-able connection, while
+// a network error does.
+func WithRetireOn(retire func(error) bool) Option {
+	return func(c *channelPool) {
+		c.retireOn = retire
+	}
+}
+
+// WithSaturationCallback makes the pool call fn(true) when its
+// utilization, the number of checked-out RPC-able connections over
+// maxCap, reaches threshold, then fn(false) when it drops back 0.1
+// below threshold, so fn is not called on each Get() or Close() around
+// the threshold. fn calls are serialized and must be fast, as they
+// delay the Get() or Close() call triggering them.
+func WithSaturationCallback(threshold float64, fn func(saturated bool)) Option {
+	return func(c *channelPool) {
+		c.saturationThreshold = threshold
+		c.onSaturation = fn
+	}
+}
+
+// WithDialTimeout limits the duration of each factory call to d,
+// after which ErrDialTimeout is returned. The context passed to a
+// FactoryContext is cancelled, while a Factory, which cannot be
+// cancelled, is abandoned and its RPC-able connection closed as soon
+// as it is created.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *channelPool) {
+		c.dialTimeout = d
+	}
+}
+
+// WithDialAttempts makes the pool call its factory up to n times
+// each time it needs a new RPC-able connection, until one succeeds.
+// Each call is subject to the dial timeout, if any. A FactoryAttempt
+// factory receives the attempt number, starting at 0, so it can pick
+// another backend than the one that just failed. The failover
+// factory, if any, is only tried once all attempts failed. n is
+// clamped to 1, the default.
+func WithDialAttempts(n int) Option {
+	return func(c *channelPool) {
+		if n < 1 {
+			n = 1
+		}
+		c.dialAttempts = n
+	}
+}
+
+// WithDialBackoff sets the delays between the WithDialAttempts()
+// factory calls, the nth retry waiting backoff.Next(n-1). The wait
+// is interrupted if the Get() context is done or the pool closed. By
+// default, attempts are not delayed.
+func WithDialBackoff(backoff *Backoff) Option {
+	return func(c *channelPool) {
+		c.dialBackoff = backoff
+	}
+}
+
+// WithMaxTotalDials caps to n the number of RPC-able connections the
+// factories can ever create, as a cost or quota control. Failed
+// dials are not counted, and closing RPC-able connections does not
+// give the budget back. Once exhausted, Get() calls finding no idle
+// RPC-able connection wait for one to be returned, as once
+// SetMaxOpenConns() is reached, or fail with ErrDialBudgetExhausted if
+// no RPC-able connection is left open. A zero n means no limit.
+func WithMaxTotalDials(n int64) Option {
+	return func(c *channelPool) {
+		if n < 0 {
+			n = 0
+		}
+		c.maxTotalDials = n
+	}
+}
+
+// WithFailoverFactory sets a factory tried each time the pool
+// factory fails to create an RPC-able connection, typically targeting
+// a secondary backend. It is subject to the same dial timeout and
+// context. RPC-able connections it creates are pooled as the others,
+// and counted in Stats().FailoverCreated. If it fails too, its error
+// is returned.
+func WithFailoverFactory(factory Factory) Option {
+	return func(c *channelPool) {
+		c.failover = nil
+		if factory != nil {
+			c.failover = func(context.Context, int) (RpcAble, map[string]string, func(), error) {
+				rconn, err := factory()
+				return rconn, nil, nil, err
+			}
+		}
+	}
+}
+
+// WithLatencyAware makes Get() hand out, among the next few idle
+// RPC-able connections, the one having the lowest average call
+// latency, instead of the oldest one.
+func WithLatencyAware(enabled bool) Option {
+	return func(c *channelPool) {
+		c.latencyAware = enabled
+	}
+}
@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"context"
+)
+
+// Pause implements the Pool interfaces Pause() method.
+func (c *channelPool) Pause() {
+	c.pauseMu.Lock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+	}
+	c.pauseMu.Unlock()
+}
+
+// Resume implements the Pool interfaces Resume() method.
+func (c *channelPool) Resume() {
+	c.pauseMu.Lock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+	}
+	c.pauseMu.Unlock()
+
+	// catch up on the min idle maintenance suspended in the meantime
+	c.wakeMinIdle()
+}
+
+// isPaused returns true if the pool is paused.
+func (c *channelPool) isPaused() bool {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	return c.resumed != nil
+}
+
+// waitResumed blocks while the pool is paused. It returns ctx.Err() if
+// ctx is done before, and ErrClosed if the pool is closed.
+func (c *channelPool) waitResumed(ctx context.Context) error {
+	c.pauseMu.Lock()
+	resumed := c.resumed
+	c.pauseMu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrClosed
+	}
+}
@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPool_PauseResume(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.Pause()
+
+	got := make(chan error)
+	go func() {
+		rconn, err := p.Get()
+		if err == nil {
+			rconn.Close()
+		}
+		got <- err
+	}()
+
+	select {
+	case err := <-got:
+		t.Fatalf("Pause error. Get() should block, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// a context bounds the wait
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Pause error. Expecting %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// idle rconns are kept
+	if p.Len() != 2 {
+		t.Errorf("Pause error. Expecting %d idle, got %d", 2, p.Len())
+	}
+
+	p.Resume()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Errorf("Resume error. Expecting no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Resume error. Get() still blocked")
+	}
+	if n := p.Stats().Created; n != 2 {
+		t.Errorf("Resume error. Expecting %d created, got %d", 2, n)
+	}
+
+	// Close() unblocks paused Get() calls
+	p.Pause()
+	go func() {
+		_, err := p.Get()
+		got <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Close()
+	select {
+	case err := <-got:
+		if err != ErrClosed {
+			t.Errorf("Pause error. Expecting %v, got %v", ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pause error. Get() still blocked after Close()")
+	}
+}
+
+func TestPool_PauseReaper(t *testing.T) {
+	p, err := NewChannelPool(2, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.Pause()
+	p.SetConnMaxIdleTime(10 * time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	if p.Len() != 2 {
+		t.Errorf("Pause error. Expecting %d idle, got %d", 2, p.Len())
+	}
+
+	p.Resume()
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if p.Len() != 0 {
+		t.Errorf("Resume error. Expecting no idle rconn, got %d", p.Len())
+	}
+}
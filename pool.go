@@ -2,12 +2,71 @@
 package pool
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 var (
 	// ErrClosed is the error resulting if the pool is closed via pool.Close().
 	ErrClosed = errors.New("pool is closed")
+
+	// ErrFull is the error resulting if an RPC-able connection is
+	// put into a full pool via pool.Put().
+	ErrFull = errors.New("pool is full")
+
+	// ErrDialTimeout is the error resulting if the factory did not
+	// create an RPC-able connection within the WithDialTimeout()
+	// duration.
+	ErrDialTimeout = errors.New("dial timeout")
+
+	// ErrAlreadyClosed is the error resulting if pool.Close() or
+	// pool.CloseContext() is called on an already closed pool.
+	ErrAlreadyClosed = errors.New("pool is already closed")
+
+	// ErrNoHealthyConn is the error resulting if a Get() call rejected
+	// more unhealthy idle RPC-able connections than the pool maximum
+	// capacity, typically because unhealthy ones keep being returned
+	// concurrently.
+	ErrNoHealthyConn = errors.New("no healthy connection")
+
+	// ErrPoolExhausted is the error resulting if a Get() call would
+	// have to wait for an RPC-able connection while WithMaxWaiters()
+	// calls are already waiting.
+	ErrPoolExhausted = errors.New("pool exhausted")
+
+	// ErrBadReply is the error resulting if the reply of a
+	// Pool.CallChecked() call is rejected by its check function.
+	ErrBadReply = errors.New("bad reply")
+
+	// ErrDialBudgetExhausted is the error resulting if a new RPC-able
+	// connection is needed while the factory already created the
+	// WithMaxTotalDials() number of RPC-able connections.
+	ErrDialBudgetExhausted = errors.New("dial budget exhausted")
+
+	// ErrNoIdle is the error resulting if a Get() call finds no idle
+	// RPC-able connection while WithNoSyncDial() or WithNoFactory() is
+	// set.
+	ErrNoIdle = errors.New("no idle connection")
+
+	// ErrNoFactory is the error resulting if a pool created with
+	// WithNoFactory() needs to create an RPC-able connection.
+	ErrNoFactory = errors.New("pool has no factory")
+
+	// ErrInvalidInitialCap is the error wrapped by the error resulting
+	// if a pool is created with a negative initial capacity.
+	ErrInvalidInitialCap = errors.New("initial capacity is negative")
+
+	// ErrInvalidMaxCap is the error wrapped by the error resulting if a
+	// pool is created with a non-positive maximum capacity.
+	ErrInvalidMaxCap = errors.New("maximum capacity is not positive")
+
+	// ErrInitialExceedsMax is the error wrapped by the error resulting
+	// if a pool is created with an initial capacity greater than its
+	// maximum capacity.
+	ErrInitialExceedsMax = errors.New("initial capacity exceeds maximum capacity")
 )
 
 // Pool interface describes a pool implementation. A pool should have maximum
@@ -16,12 +75,363 @@ type Pool interface {
 	// Get returns a new RPC-able connection from the pool. Closing a
 	// RPC-able connection puts it back to the Pool. Closing it when the
 	// pool is destroyed or full will be counted as an error.
-	Get() (RpcAble, error)
+	Get() (Conn, error)
+
+	// GetContext is like Get() but returns ctx.Err() if ctx is done
+	// and passes ctx to the factory if a new RPC-able connection has
+	// to be created. When ctx is done, ctx.Err() is returned whatever
+	// the factory returned, while the pool own limits, as
+	// WithDialTimeout(), return distinct errors, as ErrDialTimeout.
+	GetContext(ctx context.Context) (Conn, error)
+
+	// GetPriority is like GetContext() but, when the SetMaxOpenConns()
+	// limit is reached, dials one of the WithOverflowAllowance()
+	// RPC-able connections instead of waiting, if any is left. Such an
+	// RPC-able connection is closed instead of being pooled once
+	// returned.
+	GetPriority(ctx context.Context) (Conn, error)
+
+	// GetLabeled is like GetContext() but labels the checkout with
+	// label, passed to the WithOnGet() hook and set in the
+	// EventCheckedOut and EventReturned events, for example to tell
+	// which endpoint consumes the most RPC-able connections. The label
+	// is not kept by the RPC-able connection once returned.
+	GetLabeled(ctx context.Context, label string) (Conn, error)
+
+	// GetN is like GetContext() but gets n RPC-able connections at
+	// once, all or nothing: on failure, the already got ones are put
+	// back to the pool. GetN() calls are serialized, so two concurrent
+	// calls cannot each hold a part of the RPC-able connections the
+	// other is waiting for. n cannot exceed the pool maximum capacity
+	// nor the SetMaxOpenConns() limit.
+	GetN(ctx context.Context, n int) ([]RpcAble, error)
 
-	// Close closes the pool and all its RPC-able connections. After
-	// Close() the pool is no longer usable.
-	Close()
+	// GetForKey is like Get() but tries to return the same RPC-able
+	// connection as the one returned by the previous GetForKey() call
+	// with the same key, if it is idle and valid. This is a best-effort
+	// stickiness, not a guarantee.
+	GetForKey(key string) (Conn, error)
+
+	// GetValidated is like Get() but additionally closes the idle
+	// RPC-able connections for which validate returns false, until
+	// one passes or a new one is created. Newly created RPC-able
+	// connections are not validated. As for Get(), ErrNoHealthyConn
+	// is returned after more than maxCap rejected idle RPC-able
+	// connections.
+	GetValidated(validate func(RpcAble) bool) (Conn, error)
+
+	// Borrow is like Get() but returns with the RPC-able connection a
+	// release function to call instead of closing it, typically using
+	// defer. release puts the RPC-able connection back to the pool, or
+	// closes it if it has been marked unusable, and can safely be
+	// called several times. If release is directly deferred and the
+	// caller panics, the RPC-able connection is closed, as its state
+	// is unknown, before the panic goes on. The returned RpcAble is a
+	// Conn.
+	Borrow() (rconn RpcAble, release func(), err error)
+
+	// WithConn gets an RPC-able connection from the pool, calls fn
+	// with it and returns fn error. The RPC-able connection is then
+	// put back to the pool, or closed if fn error is retiring, see
+	// WithRetireOn(). By default, any error is retiring. If fn panics,
+	// the RPC-able connection is closed before the panic goes on.
+	WithConn(fn func(RpcAble) error) error
+
+	// WithConnRetry is like WithConn() but calls fn at most attempts
+	// times, each time fn returns an error for which retriable returns
+	// true, the RPC-able connection being closed before retrying with
+	// another one. If retriable is nil, rpc.ErrShutdown and io.EOF
+	// errors are retriable.
+	WithConnRetry(attempts int, retriable func(error) bool, fn func(RpcAble) error) error
+
+	// CallChecked gets an RPC-able connection from the pool and calls
+	// its Call() method, then checks reply using ok, if not nil. If ok
+	// returns false, the RPC-able connection is closed, as a suspicious
+	// reply suggests a bad connection, and ErrBadReply is returned.
+	// Otherwise, the RPC-able connection is handled as by WithConn()
+	// depending on the Call() error.
+	CallChecked(serviceMethod string, args, reply interface{}, ok func(reply interface{}) bool) error
+
+	// GoAndRelease gets an RPC-able connection from the pool and
+	// calls its Go() method, putting it back to the pool only once
+	// the call completes. The call error, or the Get() one, is then
+	// sent on the returned channel.
+	GoAndRelease(serviceMethod string, args, reply interface{}) <-chan error
+
+	// Close closes the pool and all its idle RPC-able connections, one
+	// at a time, in the order they would have been checked out. The
+	// RPC-able connections returned concurrently or later are closed
+	// by their return, so each one is closed exactly once. The Get()
+	// calls waiting for an RPC-able connection return ErrClosed. After
+	// Close() the pool is no longer usable. It returns
+	// a MultiError gathering the errors returned by the RPC-able
+	// connections, if any. Next calls return ErrAlreadyClosed and have
+	// no effect.
+	Close() error
+
+	// CloseContext is like Close() but closes the RPC-able connections
+	// concurrently and returns a *CloseError as soon as ctx is done,
+	// even if some of them are still being closed. The pool is
+	// immediately marked as closed anyway.
+	CloseContext(ctx context.Context) error
 
 	// Len returns the current number of RPC-able connections of the pool.
 	Len() int
+
+	// IsClosed returns true if the pool has been closed.
+	IsClosed() bool
+
+	// Done returns a channel closed once the pool has been closed and
+	// all its RPC-able connections too, including the checked-out
+	// ones closed by their later return. It can be called at any time
+	// and by several goroutines.
+	Done() <-chan struct{}
+
+	// HasIdle returns true if at least one idle RPC-able connection
+	// can be immediately checked out. It is an instantaneous hint, not
+	// a guarantee: a concurrent Get() may take it first. It returns
+	// false if the pool is closed.
+	HasIdle() bool
+
+	// Pause pauses the pool, typically during a backend maintenance:
+	// Get() and its variants block until Resume() is called or their
+	// context is done, and the background activities, as WithMinIdle()
+	// maintenance, health sweeps and reaping, are suspended. Idle
+	// RPC-able connections are kept, and checked-out ones can still be
+	// returned.
+	Pause()
+
+	// Resume resumes a paused pool, unblocking the Get() calls waiting.
+	Resume()
+
+	// WaitUntilReady blocks until the pool holds at least minIdle idle
+	// RPC-able connections, typically filled in the background by
+	// WithMinIdle() or a concurrent Grow(). It returns ctx.Err() if
+	// ctx is done before, and ErrClosed if the pool is closed.
+	WaitUntilReady(ctx context.Context, minIdle int) error
+
+	// Grow creates up to n new RPC-able connections and puts them in
+	// the pool, without exceeding its maximum capacity. If the factory
+	// fails, the RPC-able connections created so far are kept and an
+	// error is returned.
+	Grow(n int) error
+
+	// Shrink closes up to n idle RPC-able connections and returns how
+	// many were actually closed. Checked-out RPC-able connections are
+	// not affected.
+	Shrink(n int) int
+
+	// Flush immediately validates each idle RPC-able connection
+	// against validate, closes the failing ones and creates as many
+	// new RPC-able connections to replace them. It returns how many
+	// were replaced, fewer than the closed ones if the factory fails.
+	// Contrary to WithHealthSweep(), it is a one-shot operation, run
+	// even while the pool is paused.
+	Flush(validate func(RpcAble) error) int
+
+	// Broadcast calls serviceMethod with args concurrently on each
+	// idle RPC-able connection, discarding replies, and returns the
+	// error of each call. Checked-out RPC-able connections are not
+	// called. RPC-able connections whose call failed are closed, the
+	// others are put back into the pool.
+	Broadcast(serviceMethod string, args interface{}) []error
+
+	// HealthCheck calls ping concurrently on each idle RPC-able
+	// connection and reports the outcome, typically for a readiness
+	// probe. RPC-able connections whose ping failed are closed, the
+	// others are put back into the pool. Pings not completed when ctx
+	// is done are reported unhealthy, and their RPC-able connections
+	// closed once they complete.
+	HealthCheck(ctx context.Context, ping func(RpcAble) error) HealthReport
+
+	// Inspect returns a snapshot of the metadata of each idle RPC-able
+	// connection, in the order they would be handed out, without
+	// checking them out. It returns an empty slice if the pool is
+	// closed.
+	Inspect() []ConnInfo
+
+	// Available returns how many more RPC-able connections can be
+	// checked out before reaching the maximum capacity of the pool,
+	// i.e. maxCap, or the SetMaxOpenConns() limit if lower, minus the
+	// number of checked-out RPC-able connections. Unlike Len(), it
+	// doesn't count idle RPC-able connections. It returns 0 if the
+	// pool is closed.
+	Available() int
+
+	// Stats returns a snapshot of the pool statistics.
+	Stats() Stats
+
+	// Config returns a snapshot of the pool effective configuration,
+	// including the changes made by the setters.
+	Config() Config
+
+	// Reset closes all idle RPC-able connections, makes the
+	// checked-out ones closed instead of returned to the pool, then
+	// refills the pool with initialCap new RPC-able connections.
+	Reset() error
+
+	// SwapConnections atomically replaces the idle RPC-able
+	// connections with rconns, for a blue-green rollover: the
+	// previously idle ones are closed and the checked-out ones are
+	// closed instead of returned to the pool, as with Reset(), while
+	// next Get() calls only get rconns. ErrFull is returned without
+	// any change if rconns exceeds the maximum number of idle RPC-able
+	// connections. Once swapped, the new RPC-able connections exceeding
+	// the WithSharedLimiter() limit are closed and ErrFull is returned.
+	SwapConnections(rconns []RpcAble) error
+
+	// Put adopts an RPC-able connection created outside the pool, so
+	// it can be reused by next Get() calls. If the pool is full or
+	// closed, rconn is closed and ErrFull or ErrClosed is returned. A
+	// Conn checked out from this pool is simply returned to it, as by
+	// its Close() method, while one checked out from another pool is
+	// rejected with an error and left untouched.
+	Put(rconn RpcAble) error
+
+	// Events returns a channel on which pool events are sent. Events
+	// are only emitted once Events has been called, and dropped if the
+	// channel is full. The channel is closed when the pool is closed.
+	Events() <-chan Event
+
+	// SetConnMaxLifetime sets the maximum amount of time an RPC-able
+	// connection may be reused. Expired RPC-able connections are
+	// closed when idle, handed out or returned. If d <= 0, RPC-able
+	// connections are not closed due to their age.
+	SetConnMaxLifetime(d time.Duration)
+
+	// SetConnMaxIdleTime sets the maximum amount of time an RPC-able
+	// connection may be idle before being closed. If d <= 0, RPC-able
+	// connections are not closed due to their idle time.
+	SetConnMaxIdleTime(d time.Duration)
+
+	// SetMaxIdleConns sets the maximum number of idle RPC-able
+	// connections, closing the excess ones. It is capped to the
+	// maximum capacity of the pool. If n <= 0, no idle RPC-able
+	// connections are retained.
+	SetMaxIdleConns(n int)
+
+	// SetMaxOpenConns sets the maximum number of open RPC-able
+	// connections, idle or checked out. Once reached, Get() calls
+	// wait for an RPC-able connection to be returned or closed. If
+	// more RPC-able connections are checked out than the new limit,
+	// they are closed instead of returned until the limit is
+	// honored. If n <= 0, there is no limit, the default.
+	SetMaxOpenConns(n int)
+
+	// SetValidator replaces the WithValidator() validator called by
+	// Get() against each idle RPC-able connection before handing it
+	// out, for example once a new backend version is detected. The
+	// Get() calls in progress can still use the previous one. If
+	// validator is nil, RPC-able connections are not validated
+	// anymore.
+	SetValidator(validator func(RpcAble) error)
+}
+
+// CloseError is the error returned by Pool.CloseContext() when the
+// context is done before all RPC-able connections are closed.
+type CloseError struct {
+	// Err is the context error.
+	Err error
+	// Pending are the RPC-able connections not closed in time.
+	Pending []RpcAble
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("%d RPC-able connection(s) not closed in time: %s",
+		len(e.Pending), e.Err)
+}
+
+// Unwrap returns the context error.
+func (e *CloseError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError gathers several errors, for example returned by the
+// RPC-able connections closed by Pool.Close().
+type MultiError []error
+
+func (m MultiError) Error() string {
+	if len(m) == 1 {
+		return m[0].Error()
+	}
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(m), strings.Join(msgs, "; "))
+}
+
+// Stats contains statistics about a pool.
+type Stats struct {
+	// Created is the total number of RPC-able connections created by
+	// the factory.
+	Created int64
+	// FailoverCreated is the part of Created created by the
+	// WithFailoverFactory() factory.
+	FailoverCreated int64
+	// Closed is the total number of RPC-able connections closed by the
+	// pool.
+	Closed int64
+	// WaitCount is the total number of Get() calls that found no idle
+	// RPC-able connection and had to wait for a new one to be created
+	// or, once SetMaxOpenConns() is reached, for one to be returned.
+	WaitCount int64
+	// ExhaustedCount is the total number of Get() calls that failed
+	// with ErrPoolExhausted.
+	ExhaustedCount int64
+	// BadPuts is the total number of nil RPC-able connections, or
+	// belonging to another pool, or already returned, put back to the
+	// pool. They reveal programming errors, as the Put() and Close()
+	// errors are often ignored.
+	BadPuts int64
+	// DroppedEvents is the total number of events dropped because the
+	// Events() channel was full.
+	DroppedEvents int64
+
+	// MaxIdleClosed is the total number of RPC-able connections closed
+	// because the pool already held its maximum number of idle ones.
+	MaxIdleClosed int64
+	// IdleTimeoutClosed is the total number of RPC-able connections
+	// closed because they exceeded SetConnMaxIdleTime().
+	IdleTimeoutClosed int64
+	// MaxLifetimeClosed is the total number of RPC-able connections
+	// closed because they exceeded SetConnMaxLifetime().
+	MaxLifetimeClosed int64
+
+	// AvgLatency is the exponentially-weighted moving average of the
+	// Call() durations on all RPC-able connections of the pool.
+	AvgLatency time.Duration
+	// DialErrorRate is the exponentially-weighted moving average of
+	// the factory calls failures, between 0, no recent failure, and 1,
+	// only recent failures. Roughly the last 10 calls are taken into
+	// account.
+	DialErrorRate float64
+
+	// MaxCap is the maximum number of idle RPC-able connections.
+	MaxCap int
+	// Open is the current number of open RPC-able connections, idle or
+	// checked out.
+	Open int
+	// Idle is the current number of idle RPC-able connections.
+	Idle int
+	// InUse is the current number of RPC-able connections checked out
+	// from the pool.
+	InUse int
+	// Waiters is the current number of Get() calls waiting for an
+	// RPC-able connection to be returned or closed.
+	Waiters int
+
+	// Generation is the current generation of the pool, bumped by
+	// each Reset() call.
+	Generation uint64
+	// StaleOpen is the current number of open RPC-able connections,
+	// in practice checked out, from a generation older than
+	// Generation. They are closed as soon as returned, so a zero
+	// value means a Reset() has fully drained.
+	StaleOpen int
+
+	// Backends is the current number of open RPC-able connections per
+	// backend name for a pool created by NewWeightedPool(), nil
+	// otherwise.
+	Backends map[string]int
 }
@@ -0,0 +1,65 @@
+//go:build prometheus
+// +build prometheus
+
+package pool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collector implements prometheus.Collector on top of Pool.Stats().
+type collector struct {
+	p Pool
+
+	idle      *prometheus.Desc
+	inUse     *prometheus.Desc
+	maxCap    *prometheus.Desc
+	created   *prometheus.Desc
+	closed    *prometheus.Desc
+	waitCount *prometheus.Desc
+}
+
+// NewCollector returns a prometheus.Collector exporting the
+// statistics of p. Each Collect() call reads a fresh p.Stats()
+// snapshot.
+//
+// This function is only available when building with the
+// "prometheus" tag, so users not needing it do not depend on the
+// Prometheus client.
+func NewCollector(p Pool, constLabels prometheus.Labels) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("pool_"+name, help, nil, constLabels)
+	}
+
+	return &collector{
+		p:         p,
+		idle:      desc("idle_connections", "Number of idle connections."),
+		inUse:     desc("in_use_connections", "Number of connections currently in use."),
+		maxCap:    desc("max_connections", "Maximum number of idle connections."),
+		created:   desc("created_connections_total", "Total number of connections created."),
+		closed:    desc("closed_connections_total", "Total number of connections closed."),
+		waitCount: desc("wait_count_total", "Total number of Get() calls that waited for a new connection."),
+	}
+}
+
+// Describe implements prometheus.Collector interface.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.idle
+	ch <- c.inUse
+	ch <- c.maxCap
+	ch <- c.created
+	ch <- c.closed
+	ch <- c.waitCount
+}
+
+// Collect implements prometheus.Collector interface.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.p.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.maxCap, prometheus.GaugeValue, float64(stats.MaxCap))
+	ch <- prometheus.MustNewConstMetric(c.created, prometheus.CounterValue, float64(stats.Created))
+	ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.Closed))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+}
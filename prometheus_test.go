@@ -0,0 +1,54 @@
+//go:build prometheus
+// +build prometheus
+
+package pool
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	p, _ := newChannelPool()
+	defer p.Close()
+
+	rconn, _ := p.Get()
+	defer rconn.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewCollector(p, prometheus.Labels{"backend": "test"}))
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather error: %s", err)
+	}
+
+	values := map[string]float64{}
+	for _, family := range families {
+		metric := family.GetMetric()[0]
+		if metric.GetGauge() != nil {
+			values[family.GetName()] = metric.GetGauge().GetValue()
+		} else {
+			values[family.GetName()] = metric.GetCounter().GetValue()
+		}
+	}
+
+	expected := map[string]float64{
+		"pool_idle_connections":          float64(InitialCap - 1),
+		"pool_in_use_connections":        1,
+		"pool_max_connections":           float64(MaximumCap),
+		"pool_created_connections_total": float64(InitialCap),
+		"pool_closed_connections_total":  0,
+		"pool_wait_count_total":          0,
+	}
+	for name, value := range expected {
+		got, ok := values[name]
+		if !ok {
+			t.Errorf("Collector error. Metric %s not found", name)
+		} else if got != value {
+			t.Errorf("Collector error. Metric %s: expecting %g, got %g",
+				name, value, got)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package pool
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ReadWritePool is a pool of RPC-able connections to a primary
+// (read-write) backend and to its replicas (read-only), each kind
+// being held by its own pool.
+type ReadWritePool interface {
+	// GetRead returns an RPC-able connection to a replica, or to the
+	// primary if the replica pool is exhausted, see Pool.Available(),
+	// or fails to hand one out.
+	GetRead() (Conn, error)
+
+	// GetWrite returns an RPC-able connection to the primary.
+	GetWrite() (Conn, error)
+
+	// Primary returns the pool of the RPC-able connections to the
+	// primary, typically to tune it.
+	Primary() Pool
+
+	// Replica returns the pool of the RPC-able connections to the
+	// replicas, typically to tune it.
+	Replica() Pool
+
+	// Close closes both pools. It returns the first error, if any.
+	Close() error
+
+	// Stats returns the statistics of both pools.
+	Stats() ReadWriteStats
+}
+
+// ReadWriteStats are the statistics of a ReadWritePool, broken down
+// by role.
+type ReadWriteStats struct {
+	// Primary and Replica are the statistics of each pool.
+	Primary Stats
+	Replica Stats
+	// Reads and Writes are the numbers of RPC-able connections handed
+	// out by GetRead() and GetWrite().
+	Reads  int64
+	Writes int64
+	// ReadFallbacks is the number of RPC-able connections handed out
+	// by GetRead() from the primary pool.
+	ReadFallbacks int64
+}
+
+// readWritePool implements ReadWritePool on top of two pools.
+type readWritePool struct {
+	primary Pool
+	replica Pool
+
+	// accessed atomically
+	reads         int64
+	writes        int64
+	readFallbacks int64
+}
+
+// NewReadWritePool returns a new ReadWritePool, whose primary and
+// replica pools are created as NewChannelPool() does, using
+// respectively primary and replica factories, both with initialCap,
+// maxCap and opts.
+func NewReadWritePool(primary, replica Factory, initialCap, maxCap int, opts ...Option) (ReadWritePool, error) {
+	if primary == nil || replica == nil {
+		return nil, errors.New("factory is nil")
+	}
+
+	rw := &readWritePool{}
+	var err error
+	rw.primary, err = NewChannelPool(initialCap, maxCap, primary, opts...)
+	if err != nil {
+		return nil, err
+	}
+	rw.replica, err = NewChannelPool(initialCap, maxCap, replica, opts...)
+	if err != nil {
+		rw.primary.Close()
+		return nil, err
+	}
+	return rw, nil
+}
+
+// GetRead implements the ReadWritePool interfaces GetRead() method.
+func (rw *readWritePool) GetRead() (Conn, error) {
+	if rw.replica.Available() > 0 {
+		if rconn, err := rw.replica.Get(); err == nil {
+			atomic.AddInt64(&rw.reads, 1)
+			return rconn, nil
+		}
+	}
+
+	rconn, err := rw.primary.Get()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&rw.reads, 1)
+	atomic.AddInt64(&rw.readFallbacks, 1)
+	return rconn, nil
+}
+
+// GetWrite implements the ReadWritePool interfaces GetWrite() method.
+func (rw *readWritePool) GetWrite() (Conn, error) {
+	rconn, err := rw.primary.Get()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&rw.writes, 1)
+	return rconn, nil
+}
+
+// Primary implements the ReadWritePool interfaces Primary() method.
+func (rw *readWritePool) Primary() Pool {
+	return rw.primary
+}
+
+// Replica implements the ReadWritePool interfaces Replica() method.
+func (rw *readWritePool) Replica() Pool {
+	return rw.replica
+}
+
+// Close implements the ReadWritePool interfaces Close() method.
+func (rw *readWritePool) Close() error {
+	err := rw.primary.Close()
+	if rerr := rw.replica.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// Stats implements the ReadWritePool interfaces Stats() method.
+func (rw *readWritePool) Stats() ReadWriteStats {
+	return ReadWriteStats{
+		Primary:       rw.primary.Stats(),
+		Replica:       rw.replica.Stats(),
+		Reads:         atomic.LoadInt64(&rw.reads),
+		Writes:        atomic.LoadInt64(&rw.writes),
+		ReadFallbacks: atomic.LoadInt64(&rw.readFallbacks),
+	}
+}
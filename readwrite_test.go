@@ -0,0 +1,95 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+)
+
+// roleFactory returns a factory creating stubRconns whose id is
+// offset by base, so the role of an rconn can be told from its id.
+func roleFactory(base int) Factory {
+	factory := newStubFactory()
+	return func() (RpcAble, error) {
+		rconn, err := factory()
+		rconn.(*stubRconn).id += base
+		return rconn, err
+	}
+}
+
+const replicaBase = 1000
+
+func isReplica(rconn Conn) bool {
+	return rconn.(*PoolRconn).RpcAble.(*stubRconn).id > replicaBase
+}
+
+func TestReadWritePool(t *testing.T) {
+	rw, err := NewReadWritePool(roleFactory(0), roleFactory(replicaBase), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	// read from replica
+	read, err := rw.GetRead()
+	if err != nil {
+		t.Fatalf("GetRead error: %s", err)
+	}
+	if !isReplica(read) {
+		t.Error("GetRead error. Expecting a replica rconn")
+	}
+
+	// write from primary
+	write, err := rw.GetWrite()
+	if err != nil {
+		t.Fatalf("GetWrite error: %s", err)
+	}
+	if isReplica(write) {
+		t.Error("GetWrite error. Expecting a primary rconn")
+	}
+	write.Close()
+
+	// replica pool exhausted, read from primary
+	fallback, err := rw.GetRead()
+	if err != nil {
+		t.Fatalf("GetRead error: %s", err)
+	}
+	if isReplica(fallback) {
+		t.Error("GetRead error. Expecting a primary rconn")
+	}
+	fallback.Close()
+	read.Close()
+
+	stats := rw.Stats()
+	if stats.Reads != 2 || stats.Writes != 1 || stats.ReadFallbacks != 1 {
+		t.Errorf("Stats error. Expecting 2 reads, 1 write and 1 fallback, got %+v", stats)
+	}
+	if stats.Primary.Idle != 1 || stats.Replica.Idle != 1 {
+		t.Errorf("Stats error. Expecting 1 idle rconn per role, got %+v", stats)
+	}
+}
+
+func TestReadWritePool_ReplicaDown(t *testing.T) {
+	rw, err := NewReadWritePool(roleFactory(0), func() (RpcAble, error) {
+		return nil, errors.New("replica down")
+	}, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	read, err := rw.GetRead()
+	if err != nil {
+		t.Fatalf("GetRead error: %s", err)
+	}
+	defer read.Close()
+	if isReplica(read) {
+		t.Error("GetRead error. Expecting a primary rconn")
+	}
+	if stats := rw.Stats(); stats.ReadFallbacks != 1 {
+		t.Errorf("Stats error. Expecting 1 fallback, got %d", stats.ReadFallbacks)
+	}
+
+	if _, err := NewReadWritePool(roleFactory(0), nil, 0, 2); err == nil {
+		t.Error("NewReadWritePool error. Expecting an error for a nil factory")
+	}
+}
@@ -0,0 +1,53 @@
+package pool
+
+import (
+	"sync"
+)
+
+// Registry gathers named pools, typically one per downstream
+// service, to report their statistics at once. It is safe for
+// concurrent use.
+type Registry struct {
+	mu    sync.Mutex
+	pools map[string]Pool
+}
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{pools: map[string]Pool{}}
+}
+
+// Register registers p under name, replacing any pool already
+// registered under the same name.
+func (r *Registry) Register(name string, p Pool) {
+	r.mu.Lock()
+	r.pools[name] = p
+	r.mu.Unlock()
+}
+
+// Unregister unregisters the pool registered under name, if any. The
+// pool itself is not closed.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.pools, name)
+	r.mu.Unlock()
+}
+
+// Snapshot returns the statistics of all registered pools, indexed by
+// name. No pool can be registered or unregistered while the snapshot
+// is taken. Pools closed since their registration are unregistered
+// and so not part of the snapshot.
+func (r *Registry) Snapshot() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]Stats, len(r.pools))
+	for name, p := range r.pools {
+		if p.IsClosed() {
+			delete(r.pools, name)
+			continue
+		}
+		stats[name] = p.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	p1, err := NewChannelPool(2, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p1.Close()
+	p2, err := NewChannelPool(3, MaximumCap, newStubFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+
+	r := NewRegistry()
+	r.Register("users", p1)
+	r.Register("orders", p2)
+
+	rconn, _ := p2.Get()
+	defer rconn.Close()
+
+	snap := r.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("Snapshot error. Expecting %d pools, got %d", 2, len(snap))
+	}
+	if stats := snap["users"]; stats.Idle != 2 || stats.InUse != 0 {
+		t.Errorf("Snapshot error. Unexpected users stats: %+v", stats)
+	}
+	if stats := snap["orders"]; stats.Idle != 2 || stats.InUse != 1 {
+		t.Errorf("Snapshot error. Unexpected orders stats: %+v", stats)
+	}
+
+	// closed pools are dropped
+	p1.Close()
+	snap = r.Snapshot()
+	if _, ok := snap["users"]; ok || len(snap) != 1 {
+		t.Errorf("Snapshot error. Expecting only orders, got %v", snap)
+	}
+
+	r.Unregister("orders")
+	if snap = r.Snapshot(); len(snap) != 0 {
+		t.Errorf("Snapshot error. Expecting no pool, got %d", len(snap))
+	}
+}
@@ -0,0 +1,55 @@
+package pool
+
+import (
+	"sync/atomic"
+)
+
+// saturationHysteresis is the utilization margin below the
+// WithSaturationCallback() threshold under which the pool is
+// considered not saturated anymore, so the callback doesn't flap.
+const saturationHysteresis = 0.1
+
+// checkSaturation calls the WithSaturationCallback() function if the
+// utilization just crossed the threshold upward, or dropped back
+// below it minus the hysteresis margin. inUse is the number of
+// checked-out rconns just after the change.
+func (c *channelPool) checkSaturation(inUse int64) {
+	if c.onSaturation == nil {
+		return
+	}
+
+	// fast path, no transition
+	if c.saturationChange(inUse, atomic.LoadInt32(&c.saturated) == 1) == nil {
+		return
+	}
+
+	// re-check under lock, so transitions are notified in order
+	c.saturationMu.Lock()
+	defer c.saturationMu.Unlock()
+
+	saturated := c.saturationChange(atomic.LoadInt64(&c.inUse), atomic.LoadInt32(&c.saturated) == 1)
+	if saturated == nil {
+		return
+	}
+	if *saturated {
+		atomic.StoreInt32(&c.saturated, 1)
+	} else {
+		atomic.StoreInt32(&c.saturated, 0)
+	}
+	c.safeCall("saturation callback", func() { c.onSaturation(*saturated) })
+}
+
+// saturationChange returns the new saturation state if inUse checked
+// out rconns change the saturated state, nil otherwise.
+func (c *channelPool) saturationChange(inUse int64, saturated bool) *bool {
+	utilization := float64(inUse) / float64(c.maxCap)
+	switch {
+	case !saturated && utilization >= c.saturationThreshold:
+		saturated = true
+	case saturated && utilization < c.saturationThreshold-saturationHysteresis:
+		saturated = false
+	default:
+		return nil
+	}
+	return &saturated
+}
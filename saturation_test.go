@@ -0,0 +1,63 @@
+package pool
+
+import (
+	"testing"
+)
+
+func TestPool_SaturationCallback(t *testing.T) {
+	var calls []bool
+	p, err := NewChannelPool(0, 10, newStubFactory(),
+		WithSaturationCallback(0.5, func(saturated bool) {
+			calls = append(calls, saturated)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var rconns []Conn
+	get := func(n int) {
+		for i := 0; i < n; i++ {
+			rconn, _ := p.Get()
+			rconns = append(rconns, rconn)
+		}
+	}
+	release := func(n int) {
+		for i := 0; i < n; i++ {
+			rconns[len(rconns)-1].Close()
+			rconns = rconns[:len(rconns)-1]
+		}
+	}
+	check := func(expected ...bool) {
+		t.Helper()
+		if len(calls) != len(expected) {
+			t.Fatalf("SaturationCallback error. Expecting %v, got %v", expected, calls)
+		}
+		for i := range expected {
+			if calls[i] != expected[i] {
+				t.Fatalf("SaturationCallback error. Expecting %v, got %v", expected, calls)
+			}
+		}
+	}
+
+	get(4)
+	check()
+	get(1) // 50%
+	check(true)
+	get(2)
+	check(true)
+
+	// hysteresis
+	release(3) // 40%
+	check(true)
+	get(1)
+	release(1)
+	check(true)
+	release(1) // 30%
+	check(true, false)
+
+	get(2) // 50% again
+	check(true, false, true)
+	release(len(rconns))
+	check(true, false, true, false)
+}
@@ -0,0 +1,92 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// BackendMetaKey is the Conn.Meta() key holding the name of the
+// backend an RPC-able connection of a pool created by
+// NewWeightedPool() has been dialed to.
+const BackendMetaKey = "backend"
+
+// WeightedBackend is a backend of a pool created by NewWeightedPool().
+type WeightedBackend struct {
+	// Name identifies the backend in Conn.Meta() and Stats().Backends.
+	Name string
+	// Factory creates new RPC-able connections to the backend.
+	Factory Factory
+	// Weight is the share of the RPC-able connections dialed to the
+	// backend, relatively to the other backends weights. It must be
+	// positive.
+	Weight int
+}
+
+// weightedBalancer picks backends using the smooth weighted
+// round-robin algorithm, spreading the picks of each backend instead
+// of picking it Weight times in a row.
+type weightedBalancer struct {
+	mu       sync.Mutex
+	backends []WeightedBackend
+	current  []int
+	total    int
+}
+
+// pick returns the next backend.
+func (b *weightedBalancer) pick() *WeightedBackend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best := 0
+	for i := range b.backends {
+		b.current[i] += b.backends[i].Weight
+		if b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	b.current[best] -= b.total
+	return &b.backends[best]
+}
+
+// NewWeightedPool returns a new pool, as NewChannelPool does, dialing
+// its RPC-able connections to backends proportionally to their
+// weights. The backend of each RPC-able connection is available in
+// its metadata under BackendMetaKey, and the number of open RPC-able
+// connections per backend in Stats().Backends.
+func NewWeightedPool(backends []WeightedBackend, initialCap, maxCap int, opts ...Option) (Pool, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no backend")
+	}
+
+	b := &weightedBalancer{
+		backends: make([]WeightedBackend, len(backends)),
+		current:  make([]int, len(backends)),
+	}
+	open := make(map[string]int, len(backends))
+	for i, backend := range backends {
+		if backend.Factory == nil {
+			return nil, fmt.Errorf("backend %q factory is nil", backend.Name)
+		}
+		if backend.Weight <= 0 {
+			return nil, fmt.Errorf("backend %q weight is not positive", backend.Name)
+		}
+		if _, ok := open[backend.Name]; ok {
+			return nil, fmt.Errorf("backend %q is duplicated", backend.Name)
+		}
+		open[backend.Name] = 0
+		b.backends[i] = backend
+		b.total += backend.Weight
+	}
+
+	factory := func(context.Context, int) (RpcAble, map[string]string, func(), error) {
+		backend := b.pick()
+		rconn, err := backend.Factory()
+		return rconn, map[string]string{BackendMetaKey: backend.Name}, nil, err
+	}
+
+	// backends counters are needed by the initial fill
+	opts = append([]Option{func(c *channelPool) { c.backends = open }}, opts...)
+	return makeChannelPool(initialCap, maxCap, factory, true, opts)
+}
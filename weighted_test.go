@@ -0,0 +1,52 @@
+package pool
+
+import (
+	"testing"
+)
+
+func TestPool_Weighted(t *testing.T) {
+	p, err := NewWeightedPool([]WeightedBackend{
+		{Name: "big", Factory: newStubFactory(), Weight: 3},
+		{Name: "small", Factory: newStubFactory(), Weight: 1},
+	}, 8, MaximumCap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	backends := p.Stats().Backends
+	if backends["big"] != 6 || backends["small"] != 2 {
+		t.Errorf("Weighted error. Expecting 6 big and 2 small, got %v", backends)
+	}
+
+	// over many dials
+	dialed := map[string]int{}
+	for i := 0; i < 400; i++ {
+		rconn, err := p.GetValidated(func(RpcAble) bool { return false })
+		if err != nil {
+			t.Fatal(err)
+		}
+		dialed[rconn.Meta()[BackendMetaKey]]++
+		rconn.MarkUnusable()
+		rconn.Close()
+	}
+	if dialed["big"] != 300 || dialed["small"] != 100 {
+		t.Errorf("Weighted error. Expecting 300 big and 100 small, got %v", dialed)
+	}
+	if backends := p.Stats().Backends; backends["big"]+backends["small"] != 0 {
+		t.Errorf("Weighted error. Expecting no open rconn, got %v", backends)
+	}
+
+	if _, err := NewWeightedPool([]WeightedBackend{
+		{Name: "zero", Factory: newStubFactory()},
+	}, 0, MaximumCap); err == nil {
+		t.Errorf("Weighted error. Expecting an error for a zero weight")
+	}
+
+	// without backends, no counters
+	p2, _ := NewChannelPool(1, MaximumCap, newStubFactory())
+	defer p2.Close()
+	if backends := p2.Stats().Backends; backends != nil {
+		t.Errorf("Weighted error. Expecting nil backends, got %v", backends)
+	}
+}